@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
+	"myRestAPIWithPagination/validation"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// usage lists the subcommands of the binary. Without one, it serves the API.
+const usage = `usage: restApiWithPaginationApp [command] [flags]
+
+commands:
+  serve            serve the API (the default)
+  migrate          apply or revert schema migrations: migrate [up|down|status] [-dry-run]
+  create-user      create a user: -email, -first-name, -last-name, -password, -inactive
+  reset-password   set a new password: -email or -id, -password
+  deactivate-user  stop a user from being active: -email or -id
+  list-users       list users a page at a time: -limit, -sort, -filter, -cursor, -all
+  seed             insert generated users: -count, -seed, -start, -span, -duplicates, -active
+  purge            remove the users deleted longer ago than -older-than (DELETED_RETENTION)
+
+Passwords are read from the first line of standard input when -password is not given.
+Run a command with -h for its flags.
+`
+
+// command runs one subcommand with its arguments and returns the exit code.
+type command func(app *Config, args []string) int
+
+var commands = map[string]command{
+	"migrate":         (*Config).migrateCommand,
+	"create-user":     (*Config).createUserCommand,
+	"reset-password":  (*Config).resetPasswordCommand,
+	"deactivate-user": (*Config).deactivateUserCommand,
+	"list-users":      (*Config).listUsersCommand,
+	"seed":            (*Config).seedCommand,
+	"purge":           (*Config).purgeCommand,
+}
+
+// commandFlags returns the flag set of a subcommand, printing errors and -h to stderr.
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+
+	return flags
+}
+
+// fail prints the error of a subcommand and returns its exit code.
+func fail(name string, err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	return 1
+}
+
+// readPassword returns the password given as a flag, or else the first line of stdin,
+// so it doesn't have to end up in the shell history.
+func readPassword(flagValue string, stdin io.Reader) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("a password is required, with -password or on stdin")
+	}
+
+	return password, nil
+}
+
+// findUser returns the user picked by the -id or -email flag of a subcommand.
+func (app *Config) findUser(id, email string) (*data.User, error) {
+	var user *data.User
+	var err error
+
+	switch {
+	case id != "" && email != "":
+		return nil, errors.New("give either -id or -email, not both")
+	case id != "":
+		user, err = app.Models.User.GetOne(id)
+	case email != "":
+		user, err = app.Models.User.GetByEmail(email)
+	default:
+		return nil, errors.New("-id or -email is required")
+	}
+
+	if errors.Is(err, data.ErrNotFound) {
+		return nil, errors.New("no such user")
+	}
+
+	return user, err
+}
+
+// createUserCommand validates and inserts a user the same way POST /v1/employees
+// does.
+func (app *Config) createUserCommand(args []string) int {
+	flags := commandFlags("create-user")
+	email := flags.String("email", "", "email of the user, which they log in with")
+	firstName := flags.String("first-name", "", "first name of the user")
+	lastName := flags.String("last-name", "", "last name of the user")
+	password := flags.String("password", "", "password of the user, read from stdin when empty")
+	inactive := flags.Bool("inactive", false, "create the user as not active")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *email == "" {
+		return fail("create-user", errors.New("-email is required"))
+	}
+
+	plainText, err := readPassword(*password, os.Stdin)
+	if err != nil {
+		return fail("create-user", err)
+	}
+
+	employee := EmployeeCreate{
+		Email:     *email,
+		FirstName: *firstName,
+		LastName:  *lastName,
+		Password:  plainText,
+		Active:    !*inactive,
+	}
+	if errs := validation.Struct(employee); errs != nil {
+		return fail("create-user", errs)
+	}
+
+	id, err := app.Models.User.Insert(employee.User())
+	if err != nil {
+		return fail("create-user", err)
+	}
+
+	fmt.Println(id)
+
+	return 0
+}
+
+// resetPasswordCommand stores a new password hash for a user, instead of running the
+// UPDATE statements of DatabaseQuery.SQL by hand.
+func (app *Config) resetPasswordCommand(args []string) int {
+	flags := commandFlags("reset-password")
+	id := flags.String("id", "", "id of the user")
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "new password, read from stdin when empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	user, err := app.findUser(*id, *email)
+	if err != nil {
+		return fail("reset-password", err)
+	}
+
+	plainText, err := readPassword(*password, os.Stdin)
+	if err != nil {
+		return fail("reset-password", err)
+	}
+	if errs := validation.Var("password", plainText, "password"); errs != nil {
+		return fail("reset-password", errs)
+	}
+
+	err = app.Models.User.ResetPassword(user.ID, plainText)
+	if errors.Is(err, data.ErrNotFound) {
+		// deleted since findUser
+		return fail("reset-password", errors.New("no such user"))
+	}
+	if err != nil {
+		return fail("reset-password", err)
+	}
+
+	fmt.Printf("Reset the password of %s\n", user.Email)
+
+	return 0
+}
+
+// deactivateUserCommand clears the active flag of a user.
+func (app *Config) deactivateUserCommand(args []string) int {
+	flags := commandFlags("deactivate-user")
+	id := flags.String("id", "", "id of the user")
+	email := flags.String("email", "", "email of the user")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	user, err := app.findUser(*id, *email)
+	if err != nil {
+		return fail("deactivate-user", err)
+	}
+
+	if !user.Active {
+		fmt.Printf("%s is already inactive\n", user.Email)
+		return 0
+	}
+
+	user.Active = false
+	if err := app.Models.User.Update(*user); err != nil {
+		return fail("deactivate-user", err)
+	}
+
+	fmt.Printf("Deactivated %s\n", user.Email)
+
+	return 0
+}
+
+// listUsersCommand prints users a keyset page at a time, like GET /v1/employees.
+// The cursor it prints continues the listing on the next run, as long as CURSOR_SECRET
+// stays the same.
+func (app *Config) listUsersCommand(args []string) int {
+	flags := commandFlags("list-users")
+	limit := flags.Int("limit", defaultPageLimit, "users per page")
+	sortBy := flags.String("sort", "", "sort order, e.g. -created_at,last_name")
+	filterQuery := flags.String("filter", "", "listing filters as a query string, e.g. user_active=true&q=smith")
+	encodedCursor := flags.String("cursor", "", "cursor printed by the previous page")
+	all := flags.Bool("all", false, "print every page instead of one")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *limit < 1 || *limit > app.MaxPageLimit {
+		return fail("list-users", fmt.Errorf("-limit must be between 1 and %d", app.MaxPageLimit))
+	}
+
+	sort, err := data.UserKeyset.ParseSort(*sortBy)
+	if err != nil {
+		return fail("list-users", err)
+	}
+
+	values, err := url.ParseQuery(*filterQuery)
+	if err != nil {
+		return fail("list-users", err)
+	}
+	filter, err := app.readFilter(values)
+	if err != nil {
+		return fail("list-users", err)
+	}
+
+	// printed cursors are used whenever the operator gets back to them
+	cursors := app.Cursors
+	cursors.TTL = 0
+	query := pagination.Token{
+		Sort:       sort.String(),
+		FilterHash: pagination.HashFilter(filter.Key()),
+		Limit:      *limit,
+	}
+
+	var cursor *pagination.Cursor
+	if *encodedCursor != "" {
+		token, err := cursors.Read(*encodedCursor, query)
+		if err == nil {
+			cursor, err = data.UserKeyset.ParseCursor(sort, token.Keys, false)
+		}
+		if err != nil {
+			return fail("list-users", fmt.Errorf("invalid -cursor: %w", err))
+		}
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "ID\tEMAIL\tFIRST NAME\tLAST NAME\tACTIVE\tCREATED AT")
+
+	for {
+		users, hasMore, err := app.Models.User.GetAllForPagination(filter, sort, cursor, *limit)
+		if err != nil {
+			out.Flush()
+			return fail("list-users", err)
+		}
+
+		for _, user := range users {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%t\t%s\n",
+				user.ID, user.Email, user.FirstName, user.LastName, user.Active, user.CreatedAt.Format(time.RFC3339))
+		}
+
+		if !hasMore {
+			return flushed(out)
+		}
+
+		keys := data.UserKeyset.Keys(sort, users[len(users)-1])
+		if !*all {
+			if code := flushed(out); code != 0 {
+				return code
+			}
+			next := query
+			next.Keys = keys
+			fmt.Printf("\nmore users, with the same -sort, -filter and -limit: -cursor %s\n", cursors.Encode(next))
+			return 0
+		}
+
+		cursor, err = data.UserKeyset.ParseCursor(sort, keys, false)
+		if err != nil {
+			out.Flush()
+			return fail("list-users", err)
+		}
+	}
+}
+
+func flushed(out *tabwriter.Writer) int {
+	if err := out.Flush(); err != nil {
+		return fail("list-users", err)
+	}
+
+	return 0
+}
+
+// seedCommand bulk inserts made up users for development and benchmarks. The same
+// flags always generate the same users, so pagination edge cases found on a dataset can
+// be reproduced on demand.
+func (app *Config) seedCommand(args []string) int {
+	options := data.DefaultSeedOptions()
+
+	flags := commandFlags("seed")
+	flags.IntVar(&options.Count, "count", options.Count, "number of users")
+	flags.Uint64Var(&options.Seed, "seed", options.Seed, "seed of the generated users; reusing one inserts the same users again, which fails as duplicates")
+	flags.StringVar(&options.Password, "password", options.Password, "password of every user")
+	start := flags.String("start", options.Start.Format(time.DateOnly), "date (or RFC 3339 time) of the earliest created_at")
+	flags.DurationVar(&options.Span, "span", options.Span, "range the created_at of the users are spread over")
+	flags.Float64Var(&options.Duplicates, "duplicates", options.Duplicates, "share of users created at exactly the same time as another one")
+	flags.Float64Var(&options.Active, "active", options.Active, "share of active users")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	options.Start, err = time.Parse(time.RFC3339Nano, *start)
+	if err != nil {
+		options.Start, err = time.Parse(time.DateOnly, *start)
+	}
+	if err != nil {
+		return fail("seed", fmt.Errorf("-start must be a date or an RFC 3339 time, got %q", *start))
+	}
+	if errs := validation.Var("password", options.Password, "password"); errs != nil {
+		return fail("seed", errs)
+	}
+
+	users, err := data.GenerateUsers(options)
+	if err != nil {
+		return fail("seed", err)
+	}
+
+	if err := app.Models.User.BulkInsert(users); err != nil {
+		return fail("seed", err)
+	}
+
+	fmt.Printf("Inserted %d users generated from seed %d\n", len(users), options.Seed)
+
+	return 0
+}
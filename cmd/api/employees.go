@@ -0,0 +1,123 @@
+package main
+
+import (
+	"myRestAPIWithPagination/data"
+	"time"
+)
+
+// The API never reads or writes data.User directly. Requests are decoded into
+// EmployeeCreate and EmployeeUpdate, which have no id or timestamps for a client to set,
+// and responses are built from EmployeeView, which has no password to leak.
+
+// EmployeeCreate is the body of a request creating an employee. The lengths match the
+// varchar(50) columns of users.
+type EmployeeCreate struct {
+	Email     string `json:"email" validate:"required,email,max=50"`
+	FirstName string `json:"first_name" validate:"max=50"`
+	LastName  string `json:"last_name" validate:"max=50"`
+	Password  string `json:"password" validate:"required,password"`
+	Active    bool   `json:"user_active"`
+}
+
+// User returns the user to insert, with the plain text password Insert hashes.
+func (e EmployeeCreate) User() data.User {
+	return data.User{
+		Email:     e.Email,
+		FirstName: e.FirstName,
+		LastName:  e.LastName,
+		Password:  e.Password,
+		Active:    e.Active,
+	}
+}
+
+// EmployeeUpdate is the body of a request updating an employee. The password is changed
+// separately.
+type EmployeeUpdate struct {
+	Email     string `json:"email" validate:"required,email,max=50"`
+	FirstName string `json:"first_name" validate:"max=50"`
+	LastName  string `json:"last_name" validate:"max=50"`
+	Active    bool   `json:"user_active"`
+}
+
+// User returns the user with the given id to pass to Update.
+func (e EmployeeUpdate) User(id string) data.User {
+	return data.User{
+		ID:        id,
+		Email:     e.Email,
+		FirstName: e.FirstName,
+		LastName:  e.LastName,
+		Active:    e.Active,
+	}
+}
+
+// NewEmployeeUpdate returns the fields of a user an update can change, the document
+// PATCH requests apply to.
+func NewEmployeeUpdate(user *data.User) EmployeeUpdate {
+	return EmployeeUpdate{
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Active:    user.Active,
+	}
+}
+
+// Set copies the fields of the update onto user.
+func (e EmployeeUpdate) Set(user *data.User) {
+	user.Email = e.Email
+	user.FirstName = e.FirstName
+	user.LastName = e.LastName
+	user.Active = e.Active
+}
+
+// EmployeeView is an employee as the API responds with it.
+type EmployeeView struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name,omitempty"`
+	LastName  string    `json:"last_name,omitempty"`
+	Active    bool      `json:"user_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version is what the ETag of the employee is made of
+	Version int64 `json:"version"`
+	// DeletedAt is only set on deleted employees, listed with ?include_deleted=true
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// NewEmployeeView returns the view of a user.
+func NewEmployeeView(user *data.User) EmployeeView {
+	return EmployeeView{
+		ID:        user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Active:    user.Active,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Version:   user.Version,
+		DeletedAt: user.DeletedAt,
+	}
+}
+
+// EmployeeChange is an entry of the change feed as the API responds with it.
+type EmployeeChange struct {
+	Type      string        `json:"type"`
+	ID        string        `json:"id"`
+	ChangedAt time.Time     `json:"changed_at"`
+	Employee  *EmployeeView `json:"employee,omitempty"`
+}
+
+// NewEmployeeChange returns the view of a change feed entry.
+func NewEmployeeChange(change *data.Change) EmployeeChange {
+	view := EmployeeChange{
+		Type:      change.Type,
+		ID:        change.ID,
+		ChangedAt: change.ChangedAt,
+	}
+	if change.User != nil {
+		employee := NewEmployeeView(change.User)
+		view.Employee = &employee
+	}
+
+	return view
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"myRestAPIWithPagination/data"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the entity tag of the current version of an employee.
+func etag(user *data.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header lists tag, or is *.
+// If-None-Match compares weakly, which means ignoring the W/ of weak tags, while If-Match
+// compares strongly, which means weak tags never match.
+func matchETag(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatch returns the precondition of the If-Match header of a request changing an
+// employee, to check against the stored employee in the transaction writing it, so a
+// client can only change the version it has seen. It is nil without the header, unless
+// REQUIRE_IF_MATCH makes the header mandatory, which fails with 428.
+func (app *Config) ifMatch(r *http.Request) (func(*data.User) error, error) {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	if header == "" {
+		if app.RequireIfMatch {
+			return nil, errPreconditionRequired()
+		}
+		return nil, nil
+	}
+
+	return func(user *data.User) error {
+		if !matchETag(header, etag(user), false) {
+			return errPreconditionFailed()
+		}
+		return nil
+	}, nil
+}
+
+// notModified reports whether the If-None-Match header of a read lists the current tag,
+// and if so responds with 304 and no body.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	header := strings.Join(r.Header.Values("If-None-Match"), ",")
+	if header == "" || !matchETag(header, tag, true) {
+		return false
+	}
+
+	w.Header().Set("ETag", tag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// writeEmployee responds with an employee and its ETag. Clients may keep it, but must
+// check it is still current before using it again.
+func (app *Config) writeEmployee(w http.ResponseWriter, status int, user *data.User, headers ...http.Header) error {
+	header := http.Header{}
+	if len(headers) > 0 {
+		header = headers[0].Clone()
+	}
+	header.Set("ETag", etag(user))
+	header.Set("Cache-Control", "private, no-cache")
+
+	return app.writeJSON(w, status, NewEmployeeView(user), header)
+}
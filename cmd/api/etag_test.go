@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"2"`, false, true},
+		{`"1", "2"`, false, true},
+		{`*`, false, true},
+		{`"1"`, false, false},
+		{`W/"2"`, false, false},
+		{`W/"2"`, true, true},
+		{`W/"1", W/"3"`, true, false},
+	}
+
+	for _, tt := range tests {
+		if got := matchETag(tt.header, `"2"`, tt.weak); got != tt.want {
+			t.Errorf("matchETag(%s, weak %v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now())
+	target := employeeURL(alice.ID)
+	body := `{"email":"alice@example.com","first_name":"Alice","last_name":"Liddell","user_active":true}`
+
+	w := request(app, http.MethodPut, target, defaultAdminEmail, "application/json", body, http.Header{"If-Match": {`"2"`}})
+	if problem := decode[testProblem](t, w, http.StatusPreconditionFailed); problem.Code != codePreconditionFailed {
+		t.Errorf("stale If-Match: code %q, want %q", problem.Code, codePreconditionFailed)
+	}
+
+	w = request(app, http.MethodPut, target, defaultAdminEmail, "application/json", body, http.Header{"If-Match": {`"1"`}})
+	if updated := decode[EmployeeView](t, w, http.StatusOK); updated.FirstName != "Alice" || updated.Version != 2 {
+		t.Errorf("PUT returned %+v", updated)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("ETag = %q, want %q", etag, `"2"`)
+	}
+
+	// the version seen before the update is stale now
+	w = request(app, http.MethodDelete, target, defaultAdminEmail, "", "", http.Header{"If-Match": {`"1"`}})
+	decode[testProblem](t, w, http.StatusPreconditionFailed)
+
+	w = request(app, http.MethodGet, target, defaultAdminEmail, "", "", http.Header{"If-None-Match": {`W/"2"`}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match of the current version: %d %s", w.Code, w.Body)
+	}
+
+	app.RequireIfMatch = true
+	for _, r := range []struct{ method, contentType, body string }{
+		{http.MethodPut, "application/json", body},
+		{http.MethodPatch, "application/merge-patch+json", `{"last_name":"Smith"}`},
+		{http.MethodDelete, "", ""},
+	} {
+		w := request(app, r.method, target, defaultAdminEmail, r.contentType, r.body, nil)
+		if problem := decode[testProblem](t, w, http.StatusPreconditionRequired); problem.Code != codePreconditionRequired {
+			t.Errorf("%s without If-Match: code %q, want %q", r.method, problem.Code, codePreconditionRequired)
+		}
+	}
+
+	w = request(app, http.MethodDelete, target, defaultAdminEmail, "", "", http.Header{"If-Match": {`"2"`}})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("DELETE with the current version: %d %s", w.Code, w.Body)
+	}
+}
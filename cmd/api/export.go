@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"myRestAPIWithPagination/data"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// exportFlushRows is how many users are written between two flushes of an export, so
+// the client receives it as a steady stream of chunks.
+const exportFlushRows = 500
+
+// exportColumns are the columns of a CSV export. The password is never exported. With
+// ?include_deleted=true, a deleted_at column follows, empty for the employees that
+// aren't deleted.
+var exportColumns = []string{"id", "email", "first_name", "last_name", "user_active", "created_at", "updated_at"}
+
+// exportFormats maps ?format to the media type and file extension of the export.
+var exportFormats = map[string]struct{ contentType, extension string }{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"tsv":    {"text/tab-separated-values; charset=utf-8", "tsv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+}
+
+// ExportEmployees streams every employee matching the listing filters, in the order of
+// ?sort, as ?format=csv (the default), tsv or ndjson. The users are written as the
+// storage reads them, in chunks, so the whole set is never held in memory. Once the
+// first chunk is out the status can't change anymore, so an error midway ends the
+// download early and is only logged.
+func (app *Config) ExportEmployees(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	media, ok := exportFormats[format]
+	if !ok {
+		app.problem(w, r, errInvalidParameter(fmt.Errorf("format must be csv, tsv or ndjson, got %q", format)))
+		return
+	}
+
+	sort, err := data.UserKeyset.ParseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
+
+	filter, err := app.readFilter(r.URL.Query())
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", media.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="employees.%s"`, media.extension))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	flusher := http.NewResponseController(w)
+
+	var write func(*data.User) error
+	var flush func() error
+
+	if format == "ndjson" {
+		enc := json.NewEncoder(w)
+		write = func(user *data.User) error {
+			return enc.Encode(NewEmployeeView(user))
+		}
+		flush = flusher.Flush
+	} else {
+		out := csv.NewWriter(w)
+		if format == "tsv" {
+			out.Comma = '\t'
+		}
+		columns := exportColumns
+		if filter.IncludeDeleted {
+			columns = append(slices.Clip(columns), "deleted_at")
+		}
+		if err := out.Write(columns); err != nil {
+			return
+		}
+		write = func(user *data.User) error {
+			record := []string{
+				user.ID,
+				user.Email,
+				user.FirstName,
+				user.LastName,
+				strconv.FormatBool(user.Active),
+				user.CreatedAt.UTC().Format(time.RFC3339Nano),
+				user.UpdatedAt.UTC().Format(time.RFC3339Nano),
+			}
+			if filter.IncludeDeleted {
+				deletedAt := ""
+				if user.DeletedAt != nil {
+					deletedAt = user.DeletedAt.UTC().Format(time.RFC3339Nano)
+				}
+				record = append(record, deletedAt)
+			}
+			return out.Write(record)
+		}
+		flush = func() error {
+			out.Flush()
+			if err := out.Error(); err != nil {
+				return err
+			}
+			return flusher.Flush()
+		}
+	}
+
+	rows := 0
+	err = app.Models.User.Export(r.Context(), filter, sort, func(user *data.User) error {
+		if err := write(user); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		log.Info().Msgf("export stopped after %d rows: %v", rows, err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// exportCSV requests an export, and returns its records, header first.
+func exportCSV(t *testing.T, app *Config, query string, comma rune) [][]string {
+	t.Helper()
+
+	w := request(app, http.MethodGet, employeesPath+"/export?"+query, defaultAdminEmail, "", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	reader := csv.NewReader(w.Body)
+	reader.Comma = comma
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestExportEmployees(t *testing.T) {
+	app := newTestApp(t)
+	addUser(t, app, "bob@example.com", time.Now().Add(-time.Hour))
+	alice := addUser(t, app, "alice@example.com", time.Now().Add(-2*time.Hour))
+
+	records := exportCSV(t, app, "sort=email", ',')
+	if !slices.Equal(records[0], exportColumns) {
+		t.Errorf("the CSV header is %v, want %v", records[0], exportColumns)
+	}
+	var exported []string
+	for _, record := range records[1:] {
+		exported = append(exported, record[1])
+	}
+	if want := []string{defaultAdminEmail, "alice@example.com", "bob@example.com"}; !slices.Equal(exported, want) {
+		t.Errorf("the CSV export lists %v, want %v", exported, want)
+	}
+	if record := records[2]; record[0] != alice.ID || record[4] != "true" || record[5] != alice.CreatedAt.Format(time.RFC3339Nano) {
+		t.Errorf("alice is exported as %v", record)
+	}
+
+	if records := exportCSV(t, app, "format=tsv&email_domain=example.com&q=bob", '\t'); len(records) != 2 || records[1][1] != "bob@example.com" {
+		t.Errorf("the filtered TSV export is %v", records)
+	}
+
+	w := request(app, http.MethodGet, employeesPath+"/export?format=ndjson", defaultAdminEmail, "", "", nil)
+	if w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("the NDJSON export is sent as %s", w.Header().Get("Content-Type"))
+	}
+	scanner := bufio.NewScanner(w.Body)
+	lines := 0
+	for ; scanner.Scan(); lines++ {
+		var employee map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &employee); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := employee["password"]; ok {
+			t.Errorf("the NDJSON export has a password: %s", scanner.Text())
+		}
+	}
+	if lines != 3 {
+		t.Errorf("the NDJSON export has %d lines, want 3", lines)
+	}
+
+	w = request(app, http.MethodGet, employeesPath+"/export?format=xlsx", defaultAdminEmail, "", "", nil)
+	if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidParameter {
+		t.Errorf("format=xlsx: code %q, want %q", problem.Code, codeInvalidParameter)
+	}
+}
+
+func TestExportEmployeesIncludeDeleted(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now().Add(-time.Hour))
+	if err := app.Models.User.Delete(alice.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := exportCSV(t, app, "", ','); len(records) != 2 || len(records[0]) != len(exportColumns) {
+		t.Errorf("the export without the deleted employees is %v", records)
+	}
+
+	records := exportCSV(t, app, "include_deleted=true&sort=email", ',')
+	if header := records[0]; header[len(header)-1] != "deleted_at" {
+		t.Fatalf("the CSV header with the deleted employees is %v", header)
+	}
+	if len(records) != 3 || records[1][len(exportColumns)] != "" || records[2][0] != alice.ID || records[2][len(exportColumns)] == "" {
+		t.Errorf("the export with the deleted employees is %v", records)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, records[2][len(exportColumns)]); err != nil {
+		t.Errorf("the deleted_at of alice: %v", err)
+	}
+}
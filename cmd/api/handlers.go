@@ -1,21 +1,14 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
-	"github.com/rs/zerolog/log"
 )
 
 // func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
@@ -85,44 +78,41 @@ import (
 // 	return nil
 // }
 
+// CreateEmployee creates an employee and responds with 201, the employee, and its URL in
+// the Location header.
 func (app *Config) CreateEmployee(w http.ResponseWriter, r *http.Request) {
-	var user data.User
+	var employee EmployeeCreate
 
-	data, err := io.ReadAll(r.Body)
+	err := app.readJSON(w, r, &employee)
 	if err != nil {
-		app.errorJSON(w, err)
-	}
-
-	err = json.Unmarshal(data, &user)
-	if err != nil {
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		app.problem(w, r, err)
+		return
 	}
 
 	// log.Info().Msgf("Unmarshalling user json data: %v", user)
 
-	_, err = app.Models.User.Insert(user)
+	id, err := app.Models.User.Insert(employee.User())
 	if err != nil {
-		// log.Info().Msgf("Internal error: can't store to db:%v", err)
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			// fmt.Println(pgErr.Message)
-			// fmt.Println(pgErr.Code)
-			switch pgErr.Code {
-			case pgerrcode.UniqueViolation:
-				http.Error(w, "Provided value already exists", http.StatusBadRequest) // the provided value already exists in the database
-			default:
-				http.Error(w, "Internal error: can't store to db", http.StatusInternalServerError)
-			}
-
-		}
+		// a taken email is a conflict, anything else couldn't be stored
+		app.problem(w, r, err)
+		return
+	}
 
+	// read it back for the timestamps the storage set
+	user, err := app.Models.User.GetOne(id)
+	if err != nil {
+		app.problem(w, r, errInternal("the employee was created but couldn't be read back", err))
+		return
 	}
+
+	app.writeEmployee(w, http.StatusCreated, user, http.Header{
+		"Location": []string{employeeURL(id)},
+	})
 }
 
 func (app *Config) GetEmployeeByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	// v := r.URL.Query().Get("v")
-	fmt.Println("Url Parameters:", id)
 	// fmt.Println("Query:", v)
 
 	// userId, err := strconv.Atoi(id)
@@ -130,77 +120,80 @@ func (app *Config) GetEmployeeByID(w http.ResponseWriter, r *http.Request) {
 	// 	http.Error(w, "Provided id is of unsupported format", http.StatusBadRequest)
 	// }
 
-	// check if the id does exist or not. If the id doesn't exist then it would crash the application
-	// err = app.Models.User.CheckId(userId)
-	err := app.Models.User.CheckId(id)
-	if err == nil {
-		// Now, get the user as the id does exist
-		// user, err := app.Models.User.GetOne(userId)
-		user, err := app.Models.User.GetOne(id)
-		if err != nil {
-			http.Error(w, "could not fetch record from db", http.StatusInternalServerError)
-		}
-		user.Password = "-"
-		app.writeJSON(w, http.StatusAccepted, user)
-	} else {
-		// log.Info().Msgf("user id check error:- %v", err)
-		http.Error(w, "Provided id doesn't exist", http.StatusBadRequest)
+	// a missing id is reported as not found by GetOne
+	// user, err := app.Models.User.GetOne(userId)
+	user, err := app.Models.User.GetOne(id)
+	if err != nil {
+		app.problem(w, r, err)
+		return
 	}
 
+	// a client that has this version already doesn't need it again
+	if notModified(w, r, etag(user)) {
+		return
+	}
+
+	app.writeEmployee(w, http.StatusOK, user)
 }
 
+// UpdateEmployee replaces the employee with the body, and responds with the result. With
+// If-Match, only the version of the employee it names is replaced.
 func (app *Config) UpdateEmployee(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	// v := r.URL.Query().Get("v")
-	fmt.Println("Url Parameters:", id)
 	// fmt.Println("Query:", v)
 
-	// userId, err := strconv.Atoi(id)
-	// if err != nil {
-	// 	http.Error(w, "Provided id is of unsupported format", http.StatusBadRequest)
-	// }
-
-	// check if the id does exist or not. If the id doesn't exist then it would crash the application
-	// err = app.Models.User.CheckId(userId)
+	// check if the id does exist or not before reading the body, so a missing user is
+	// reported as such rather than as an invalid body
 	err := app.Models.User.CheckId(id)
-	if err == nil {
-		// Now, update the user as the id does exist
-		var user data.User
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
 
-		data, err := io.ReadAll(r.Body)
-		if err != nil {
-			app.errorJSON(w, err)
-		}
+	check, err := app.ifMatch(r)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
 
-		err = json.Unmarshal(data, &user)
-		if err != nil {
-			http.Error(w, "Internal error", http.StatusInternalServerError)
-		}
-		user.Password = "-"
-		// user.ID = userId
-		user.ID = id
-		// User's password can't/shouldn't be changed through this method
-		app.Models.User = user
-		err = app.Models.User.Update()
-		if err != nil {
-			http.Error(w, "could not update the record in db", http.StatusInternalServerError)
+	var employee EmployeeUpdate
+
+	err = app.readJSON(w, r, &employee)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	// User's password can't/shouldn't be changed through this method, EmployeeUpdate
+	// has none. The version is checked and the fields replaced in one transaction.
+	user, err := app.Models.User.Patch(id, func(user *data.User) error {
+		if check != nil {
+			if err := check(user); err != nil {
+				return err
+			}
 		}
-	} else {
-		http.Error(w, "Provided user doesn't exist", http.StatusBadRequest)
+
+		employee.Set(user)
+		return nil
+	})
+	if err != nil {
+		app.problem(w, r, err)
+		return
 	}
+
+	app.writeEmployee(w, http.StatusOK, user)
 }
 
+// DeleteEmployee deletes an employee and responds with 204. Only the admin may delete
+// other employees than themselves. With If-Match, only the version it names is deleted.
+// The employee is only marked as deleted, so RestoreEmployee can bring it back until the
+// purge job removes it for good.
 func (app *Config) DeleteEmployee(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	// v := r.URL.Query().Get("v")
-	fmt.Println("Url Parameters:", id)
 	// fmt.Println("Query:", v)
 
-	userId, err := strconv.Atoi(id)
-	if err != nil {
-		http.Error(w, "Provided id is of unsupported format", http.StatusBadRequest)
-	}
-
 	// Now, check if the user is trying to delete other users or itself
 	// If the user is a admin only then we'll let it delete other users
 	// otherwise it would not be able to delete users other than itself
@@ -208,145 +201,316 @@ func (app *Config) DeleteEmployee(w http.ResponseWriter, r *http.Request) {
 
 	// check if the user is admin or not and also get the user id of the actual user who is making the request
 	// requestMakingUserID, admin := app.GetIDOfRequestMakingUser(w, r)
-	requestMakingUser, admin := app.GetIDOfRequestMakingUser(w, r)
-	if admin {
-		err := app.Models.User.DeleteByID(userId)
-		if err != nil {
-			http.Error(w, "could not delete the record from db", http.StatusInternalServerError)
-		}
-	} else {
-		app.Models.User = *requestMakingUser
-		err = app.Models.User.Delete()
-		if err != nil {
-			http.Error(w, "could not delete the record from db", http.StatusInternalServerError)
-		}
+	requestMakingUser, admin, err := app.GetIDOfRequestMakingUser(r)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	if !admin && id != requestMakingUser.ID {
+		app.problem(w, r, errForbidden("only the admin can delete other employees"))
+		return
+	}
+
+	check, err := app.ifMatch(r)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	err = app.Models.User.Delete(id, check)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreEmployee brings back a deleted employee and responds with it. Only the admin may
+// restore employees. Restoring an employee that isn't deleted changes nothing.
+func (app *Config) RestoreEmployee(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	_, admin, err := app.GetIDOfRequestMakingUser(r)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	if !admin {
+		app.problem(w, r, errForbidden("only the admin can restore employees"))
+		return
+	}
+
+	err = app.Models.User.Restore(id)
+	if err != nil {
+		app.problem(w, r, err)
+		return
 	}
+
+	user, err := app.Models.User.GetOne(id)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	app.writeEmployee(w, http.StatusOK, user)
 }
 
-func (app *Config) GetIDOfRequestMakingUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
-	isAdmin := false
-	var newUser *data.User
+// GetIDOfRequestMakingUser returns the user making the request, whose credentials
+// Authenticate has checked, and whether they are the admin, the user with ADMIN_EMAIL.
+func (app *Config) GetIDOfRequestMakingUser(r *http.Request) (*data.User, bool, error) {
 	username, _, ok := r.BasicAuth()
-	if ok {
-		// validate the user against the database
-		user, err := app.Models.User.GetByEmail(username)
-		if err != nil {
-			app.errorJSON(w, errors.New("couldn't fetch record from db"), http.StatusInternalServerError)
-			return &data.User{}, isAdmin
-		}
-		newUser = user
-		if user.Email == "admin.example.com" {
-			isAdmin = true
-		}
+	if !ok {
+		return nil, false, errUnauthorized("authentication required")
 	}
 
-	return newUser, isAdmin
+	// validate the user against the database
+	user, err := app.Models.User.GetByEmail(username)
+	if errors.Is(err, data.ErrNotFound) {
+		return nil, false, errUnauthorized("invalid credentials")
+	}
+	if err != nil {
+		return nil, false, errInternal("the user making the request couldn't be fetched", err)
+	}
+
+	return user, user.Email == app.AdminEmail, nil
 }
 
-func (app *Config) GetAllEmployee(w http.ResponseWriter, r *http.Request) {
-	var AllUsers []*data.User
-
-	limitNumber := chi.URLParam(r, "limit")
-	// cursorAsTimeStamp := r.URL.Query().Get("cursor")
-	cursorAsTimeStamp := chi.URLParam(r, "cursor")
-	fmt.Println("Url Parameters:", limitNumber)
-	fmt.Println("length of Cursor:", len(cursorAsTimeStamp))
-	fmt.Println("Cursor:", cursorAsTimeStamp)
-
-	var decodeCursorStringTime time.Time
-	var decodeCursorStringUUID string
-	var err error
-	var isFirstQuery bool
-
-	if len(cursorAsTimeStamp) > 0 && cursorAsTimeStamp == "first" {
-		// decodeCursorStringTime = time.Now()
-		isFirstQuery = true
-		decodeCursorStringTime = time.Date(1970, time.Month(1), 0, 0, 0, 0, 0, time.UTC) // epoch time: 1970, 1 January 00:00:00 UTC
-		decodeCursorStringUUID = "aaaaaaa"
-	} else {
-		isFirstQuery = false
-		decodeCursorStringTime, decodeCursorStringUUID, err = decodeCursor(cursorAsTimeStamp)
-		if err != nil {
-			app.errorJSON(w, errors.New("provided cursor is invalid"), http.StatusInternalServerError)
-			log.Info().Msgf("Provided cursor is invalid:%v", err)
-			return
-		}
+// ListEmployees is the listing of /v1/employees: keyset pages, ?limit=20&cursor=...,
+// unless ?page or ?per_page ask for numbered pages, see GetEmployeePage.
+func (app *Config) ListEmployees(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("page") || r.URL.Query().Has("per_page") {
+		app.GetEmployeePage(w, r)
+		return
 	}
 
-	log.Info().Msgf("decodeCursorStringTime:%v", decodeCursorStringTime)
-	log.Info().Msgf("decodeCursorStringUUID:%v", decodeCursorStringUUID)
+	params, err := pagination.ParseParams(r.URL.Query(), defaultPageLimit, app.MaxPageLimit)
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
 
-	// decodeCursorStringTime:2024-06-02 05:00:36.357147 +0000 UTC" but we have to remove " +0000 UTC" part
-	// from the timestamp otherwise sql query crashes and as a result returns empty slice of all users
+	app.getCursorPage(w, r, params)
+}
 
-	AllUsers, err = app.Models.User.GetAllForPagination(decodeCursorStringTime, decodeCursorStringUUID, isFirstQuery)
+// GetAllEmployee is the legacy keyset listing, taking the limit and cursor from the
+// path: /get-all-employee/20/first for the first page.
+func (app *Config) GetAllEmployee(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.ParseParams(r.URL.Query(), defaultPageLimit, app.MaxPageLimit)
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
+
+	params.Limit, err = pagination.ParseLimit(chi.URLParam(r, "limit"), app.MaxPageLimit)
 	if err != nil {
-		log.Info().Msgf("couldn't fetch record from db: %v", err)
-		app.errorJSON(w, errors.New("couldn't fetch record from db"), http.StatusInternalServerError)
+		app.problem(w, r, errInvalidParameter(err))
 		return
 	}
 
-	log.Info().Msgf("AllUsers:%v", AllUsers)
+	// the first page is requested with the "first" placeholder instead of a cursor
+	params.Cursor = chi.URLParam(r, "cursor")
+	if params.Cursor == "first" {
+		params.Cursor = ""
+	}
+
+	app.getCursorPage(w, r, params)
+}
 
-	// LastElementTimeForThisPage := AllUsers[len(AllUsers)-1].CreatedAt
-	// LastElementUUIDForThisPage := AllUsers[len(AllUsers)-1].ID
+// getCursorPage responds with the keyset page of employees params ask for.
+func (app *Config) getCursorPage(w http.ResponseWriter, r *http.Request, params pagination.Params) {
+	sort, err := data.UserKeyset.ParseSort(params.Sort)
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
 
-	if len(AllUsers) > 0 {
-		// LastElementTimeForThisPage := AllUsers[0].CreatedAt
-		// LastElementUUIDForThisPage := AllUsers[0].ID
-		LastElementTimeForThisPage := AllUsers[len(AllUsers)-1].CreatedAt
-		LastElementUUIDForThisPage := AllUsers[len(AllUsers)-1].ID
-		log.Info().Msgf("encodeCursor before encoding: LastElementTimeForThisPage %v", LastElementTimeForThisPage)
-		log.Info().Msgf("encodeCursor before encoding: LastElementUUIDForThisPage %v", LastElementUUIDForThisPage)
+	filter, err := app.readFilter(r.URL.Query())
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
 
-		EncodedCursorString := encodeCursor(LastElementTimeForThisPage, LastElementUUIDForThisPage)
+	query := pagination.Token{
+		Sort:       sort.String(),
+		FilterHash: pagination.HashFilter(filter.Key()),
+		Limit:      params.Limit,
+	}
 
-		type Result struct {
-			Employees []*data.User
-			TotalItem int
-			Cursor    string
+	var token *pagination.Token
+	var cursor *pagination.Cursor
+	if params.Cursor != "" {
+		token, err = app.Cursors.Read(params.Cursor, query)
+		if err == nil {
+			cursor, err = data.UserKeyset.ParseCursor(sort, token.Keys, token.Backward)
 		}
+		if err == nil {
+			filter.AsOf, err = token.SnapshotTime()
+		}
+		if err != nil {
+			app.problem(w, r, errInvalidCursor(err))
+			return
+		}
+	} else if params.Snapshot {
+		// ?snapshot=true pins the traversal to now: users created after it are left out
+		// and users deleted after it are kept, so every user is listed exactly once. What
+		// is pinned is which users there are, not their fields: users updated meanwhile
+		// show their current values, and are matched against the filters by them.
+		now := time.Now().UTC()
+		filter.AsOf = &now
+	}
 
-		NewResult := Result{
-			Employees: AllUsers,
-			TotalItem: len(AllUsers),
-			Cursor:    EncodedCursorString,
+	// a snapshot traversal carries its moment from page to page in the cursors
+	if filter.AsOf != nil {
+		if err := data.CheckSnapshotSort(sort); err != nil {
+			app.problem(w, r, errInvalidParameter(err))
+			return
 		}
+		query.AsOf = filter.AsOf.Format(time.RFC3339Nano)
+	}
 
-		app.writeJSON(w, http.StatusAccepted, NewResult)
-	} else {
-		app.errorJSON(w, errors.New("there is no more record"), http.StatusBadRequest)
+	AllUsers, hasMore, err := app.Models.User.GetAllForPagination(filter, sort, cursor, params.Limit)
+	if err != nil {
+		app.problem(w, r, errInternal("couldn't fetch record from db", err))
 		return
 	}
 
-	// log.Info().Msgf("all employees: %v", allUsers)
+	page := pagination.MapItems(pagination.CursorPage(app.Cursors, AllUsers, hasMore, query, token, func(u *data.User) []string {
+		return data.UserKeyset.Keys(sort, u)
+	}), NewEmployeeView)
+
+	if params.Count != pagination.CountNone {
+		count, err := app.countUsers(filter, params.Count)
+		if err != nil {
+			app.problem(w, r, errInternal("couldn't count records in db", err))
+			return
+		}
+		page.SetCount(count)
+	}
 
+	app.writeJSON(w, http.StatusOK, page)
 }
 
-func decodeCursor(encodedCursor string) (res time.Time, uuid string, err error) {
-	// encodedCursor = strings.TrimSpace(encodedCursor)
-	byt, err := base64.StdEncoding.DecodeString(encodedCursor)
+// GetEmployeePage is the page number flavour of GetAllEmployee, for clients that need
+// to jump straight to a page: ?page=37&per_page=20. It takes the same filter and sort
+// parameters, always includes the exact total, and links the first, previous, next and
+// last pages in the Link header.
+func (app *Config) GetEmployeePage(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.ParseParams(r.URL.Query(), defaultPageLimit, app.MaxPageLimit)
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
+
+	sort, err := data.UserKeyset.ParseSort(params.Sort)
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
+
+	filter, err := app.readFilter(r.URL.Query())
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
+		return
+	}
+
+	count, err := app.countUsers(filter, pagination.CountExact)
 	if err != nil {
+		app.problem(w, r, errInternal("couldn't count records in db", err))
 		return
 	}
 
-	arrStr := strings.Split(string(byt), ",")
-	if len(arrStr) != 2 {
-		err = errors.New("cursor is invalid")
+	AllUsers, err := app.Models.User.GetPage(filter, sort, (params.Page-1)*params.PerPage, params.PerPage)
+	if err != nil {
+		app.problem(w, r, errInternal("couldn't fetch record from db", err))
+		return
+	}
+
+	page := pagination.MapItems(pagination.NumberedPage(AllUsers, params.Page, params.PerPage, count.Count), NewEmployeeView)
+
+	app.writeJSON(w, http.StatusOK, page, http.Header{
+		"Link": []string{page.Link(r.URL)},
+	})
+}
+
+// GetEmployeeChanges is the change feed sync clients use to keep a local copy of the
+// directory: /v1/employees/changes?since=<cursor>&limit=100. Without since it starts from
+// the beginning. Every response carries the next_cursor to send as since on the next
+// call, and has_more tells whether to call again right away.
+//
+// Changes are stamped when they are written, not when they commit, so a write can
+// commit after another one stamped later. The feed only reaches up to ChangeFeedLag ago,
+// for the clients not to move past a stamp whose write hasn't committed yet.
+//
+// The tombstones of deleted employees are purged with them, after DeletedRetention. A
+// since further back than that is refused as expired, and the client starts over.
+func (app *Config) GetEmployeeChanges(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.ParseParams(r.URL.Query(), app.MaxPageLimit, app.MaxPageLimit)
+	if err != nil {
+		app.problem(w, r, errInvalidParameter(err))
 		return
 	}
 
-	res, err = time.Parse(time.RFC3339Nano, arrStr[0])
-	// res, err = time.Parse(time.UTC.String(), arrStr[0]) ISO8601
+	// clients keep the feed position for as long as they like, with any batch size, so
+	// feed cursors neither expire nor remember the limit
+	feed := app.Cursors
+	feed.TTL = 0
+	query := pagination.Token{
+		Sort:       data.ChangeKeyset.Default.String(),
+		FilterHash: pagination.HashFilter("changes"),
+	}
+
+	var token *pagination.Token
+	var since *pagination.Cursor
+	if encodedCursor := r.URL.Query().Get("since"); encodedCursor != "" {
+		token, err = feed.Read(encodedCursor, query)
+		if err == nil {
+			since, err = data.ChangeKeyset.ParseCursor(data.ChangeKeyset.Default, token.Keys, false)
+		}
+		if err == nil && app.DeletedRetention > 0 {
+			if changedAt := since.Values[0].(time.Time); changedAt.Before(time.Now().Add(-app.DeletedRetention)) {
+				err = fmt.Errorf("the feed position %s is older than the deleted employees", changedAt)
+			}
+		}
+		if err != nil {
+			app.problem(w, r, errInvalidCursor(err))
+			return
+		}
+	}
+
+	changes, hasMore, err := app.Models.User.GetChanges(since, time.Now().Add(-app.ChangeFeedLag), params.Limit)
 	if err != nil {
+		app.problem(w, r, errInternal("couldn't fetch changes from db", err))
 		return
 	}
-	uuid = arrStr[1]
 
-	return
+	page := pagination.MapItems(pagination.Page[*data.Change]{
+		Items:     changes,
+		TotalItem: len(changes),
+		HasMore:   hasMore,
+	}, NewEmployeeChange)
+
+	// with nothing new the client stays where it is
+	next := query
+	switch {
+	case len(changes) > 0:
+		next.Keys = data.ChangeKeyset.Keys(data.ChangeKeyset.Default, changes[len(changes)-1])
+		page.NextCursor = feed.Encode(next)
+	case token != nil:
+		next.Keys = token.Keys
+		page.NextCursor = feed.Encode(next)
+	}
+
+	app.writeJSON(w, http.StatusOK, page)
 }
 
-func encodeCursor(t time.Time, uuid string) string {
-	key := fmt.Sprintf("%s,%s", t.Format(time.RFC3339Nano), uuid)
-	return base64.StdEncoding.EncodeToString([]byte(key))
+// countUsers returns the total number of users matching the filter, of the requested
+// kind, cached for a short while per filter.
+func (app *Config) countUsers(filter data.Filter, kind string) (pagination.Count, error) {
+	return app.Counts.Count("users|"+filter.Key(), kind,
+		func() (int64, error) { return app.Models.User.Count(filter) },
+		func() (int64, error) { return app.Models.User.EstimateCount(filter) },
+	)
 }
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListEmployeesCursors(t *testing.T) {
+	app := newTestApp(t)
+
+	// pairs of users share their created_at, so pages have to use the id tiebreaker
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 24; i++ {
+		addUser(t, app, fmt.Sprintf("user%02d@example.com", i), start.Add(time.Duration(i/2)*time.Minute))
+	}
+
+	for _, sort := range []string{"", "-created_at", "email", "user_active,-last_name"} {
+		t.Run("sort="+sort, func(t *testing.T) {
+			all := walk(t, app, url.Values{"sort": {sort}, "limit": {"100"}})
+			if len(all) != 1 || len(all[0]) != 25 {
+				t.Fatalf("a single page of 100 has %v", all)
+			}
+
+			pages := walk(t, app, url.Values{"sort": {sort}, "limit": {"10"}})
+			if got := slices.Concat(pages...); !slices.Equal(got, all[0]) {
+				t.Errorf("pages of 10 list %v, want %v", got, all[0])
+			}
+			if len(pages) != 3 || len(pages[2]) != 5 {
+				t.Errorf("pages of 10 have %d, %d and %d users", len(pages[0]), len(pages[1]), len(pages[len(pages)-1]))
+			}
+		})
+	}
+}
+
+func TestListEmployeesFilters(t *testing.T) {
+	app := newTestApp(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, email := range []string{"alice@example.com", "albert@corp.example", "bernard@corp.example", "carol@example.com"} {
+		addUser(t, app, email, start.Add(time.Duration(i)*time.Hour))
+	}
+	carol, err := app.Models.User.GetByEmail("carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol.Active = false
+	if err := app.Models.User.Update(*carol); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"user_active=false", []string{"carol@example.com"}},
+		{"email_domain=CORP.example", []string{"albert@corp.example", "bernard@corp.example"}},
+		{"name_prefix=al", []string{"alice@example.com", "albert@corp.example"}},
+		{"q=ber", []string{"albert@corp.example", "bernard@corp.example"}},
+		{"q=50%25", nil},
+		{"created_after=2024-01-01T01:00:00Z&created_before=2024-01-01T03:00:00Z", []string{"albert@corp.example", "bernard@corp.example"}},
+		{"email_domain=example.com&created_before=2024-01-02", []string{"alice@example.com", "carol@example.com"}},
+	}
+
+	for _, tt := range tests {
+		w := request(app, http.MethodGet, employeesPath+"?"+tt.query, defaultAdminEmail, "", "", nil)
+		page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+		if got := emails(page.Items); !slices.Equal(got, tt.want) {
+			t.Errorf("%s lists %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"user_active=maybe", "created_after=yesterday"} {
+		w := request(app, http.MethodGet, employeesPath+"?"+query, defaultAdminEmail, "", "", nil)
+		if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidParameter {
+			t.Errorf("%s: code %q, want %q", query, problem.Code, codeInvalidParameter)
+		}
+	}
+}
+
+func TestListEmployeesPrevCursor(t *testing.T) {
+	app := newTestApp(t)
+	for i := 0; i < 9; i++ {
+		addUser(t, app, fmt.Sprintf("user%d@example.com", i), time.Now().Add(time.Duration(i)*time.Second))
+	}
+
+	w := request(app, http.MethodGet, employeesPath+"?limit=4", defaultAdminEmail, "", "", nil)
+	first := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+	w = request(app, http.MethodGet, employeesPath+"?limit=4&cursor="+first.NextCursor, defaultAdminEmail, "", "", nil)
+	second := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+	w = request(app, http.MethodGet, employeesPath+"?limit=4&cursor="+second.PrevCursor, defaultAdminEmail, "", "", nil)
+	back := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+	if !slices.Equal(ids(back.Items), ids(first.Items)) {
+		t.Errorf("going back lists %v, want the first page %v", ids(back.Items), ids(first.Items))
+	}
+	if back.PrevCursor != "" {
+		t.Errorf("the first page has a prev_cursor")
+	}
+}
+
+func TestListEmployeesRefusesInvalidCursors(t *testing.T) {
+	app := newTestApp(t)
+	addUser(t, app, "alice@example.com", time.Now())
+
+	w := request(app, http.MethodGet, employeesPath+"?limit=1", defaultAdminEmail, "", "", nil)
+	page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+	for name, target := range map[string]string{
+		"tampered":     employeesPath + "?limit=1&cursor=" + page.NextCursor[:len(page.NextCursor)-2] + "AA",
+		"other limit":  employeesPath + "?limit=2&cursor=" + page.NextCursor,
+		"other sort":   employeesPath + "?limit=1&sort=email&cursor=" + page.NextCursor,
+		"other filter": employeesPath + "?limit=1&user_active=true&cursor=" + page.NextCursor,
+	} {
+		w := request(app, http.MethodGet, target, defaultAdminEmail, "", "", nil)
+		if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidCursor {
+			t.Errorf("%s: code %q, want %q", name, problem.Code, codeInvalidCursor)
+		}
+	}
+}
+
+func TestListEmployeesCount(t *testing.T) {
+	app := newTestApp(t)
+	for i := 0; i < 4; i++ {
+		addUser(t, app, fmt.Sprintf("user%d@example.com", i), time.Now())
+	}
+
+	tests := []struct {
+		query     string
+		wantCount int64
+		wantType  string
+	}{
+		{"limit=2", -1, ""},
+		{"limit=2&count=none", -1, ""},
+		{"limit=2&count=exact", 5, pagination.CountExact},
+		{"limit=2&count=exact&email_domain=other.example", 0, pagination.CountExact},
+		// an estimate this small is cheap enough to be counted exactly
+		{"limit=2&count=estimate", 5, pagination.CountExact},
+	}
+
+	for _, tt := range tests {
+		w := request(app, http.MethodGet, employeesPath+"?"+tt.query, defaultAdminEmail, "", "", nil)
+		page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+		count := int64(-1)
+		if page.TotalCount != nil {
+			count = *page.TotalCount
+		}
+		if count != tt.wantCount || page.CountType != tt.wantType {
+			t.Errorf("%s: total_count %d of type %q, want %d of type %q", tt.query, count, page.CountType, tt.wantCount, tt.wantType)
+		}
+	}
+
+	w := request(app, http.MethodGet, employeesPath+"?count=all", defaultAdminEmail, "", "", nil)
+	if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidParameter {
+		t.Errorf("count=all: code %q, want %q", problem.Code, codeInvalidParameter)
+	}
+}
+
+func TestListEmployeesPages(t *testing.T) {
+	app := newTestApp(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		addUser(t, app, fmt.Sprintf("user%d@example.com", i), start.Add(time.Duration(i)*time.Minute))
+	}
+
+	w := request(app, http.MethodGet, employeesPath+"?page=2&per_page=2", defaultAdminEmail, "", "", nil)
+	page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+	if got, want := emails(page.Items), []string{"user2@example.com", "user3@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("page 2 lists %v, want %v", got, want)
+	}
+	if page.Page != 2 || page.PerPage != 2 || page.TotalPages != 3 || *page.TotalCount != 5 || !page.HasMore {
+		t.Errorf("page 2 is page %d of %d, %d per page, %d in total, has_more %v", page.Page, page.TotalPages, page.PerPage, *page.TotalCount, page.HasMore)
+	}
+
+	link := w.Header().Get("Link")
+	for _, want := range []string{
+		`</v1/employees?page=1&per_page=2>; rel="first"`,
+		`</v1/employees?page=1&per_page=2>; rel="prev"`,
+		`</v1/employees?page=3&per_page=2>; rel="next"`,
+		`</v1/employees?page=3&per_page=2>; rel="last"`,
+	} {
+		if !strings.Contains(link, want) {
+			t.Errorf("Link %q has no %s", link, want)
+		}
+	}
+
+	w = request(app, http.MethodGet, employeesPath+"?page=9&per_page=2", defaultAdminEmail, "", "", nil)
+	if page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK); len(page.Items) != 0 || page.HasMore {
+		t.Errorf("a page past the last one lists %v, has_more %v", emails(page.Items), page.HasMore)
+	}
+
+	// pages whose offset would overflow are refused instead of wrapping around
+	for _, query := range []string{"page=0", "page=4611686018427387905&per_page=2", fmt.Sprintf("page=%d", math.MaxInt)} {
+		w := request(app, http.MethodGet, employeesPath+"?"+query, defaultAdminEmail, "", "", nil)
+		if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidParameter {
+			t.Errorf("%s: code %q, want %q", query, problem.Code, codeInvalidParameter)
+		}
+	}
+}
+
+func TestEmployeeChanges(t *testing.T) {
+	app := newTestApp(t)
+	admin, err := app.Models.User.GetByEmail(defaultAdminEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := addUser(t, app, "alice@example.com", time.Now().Add(-2*time.Minute))
+	bob := addUser(t, app, "bob@example.com", time.Now().Add(-time.Minute))
+
+	changes := func(since string) pagination.Page[EmployeeChange] {
+		t.Helper()
+		w := request(app, http.MethodGet, employeesPath+"/changes?limit=10&since="+since, defaultAdminEmail, "", "", nil)
+		return decode[pagination.Page[EmployeeChange]](t, w, http.StatusOK)
+	}
+	summary := func(page pagination.Page[EmployeeChange]) []string {
+		var entries []string
+		for _, change := range page.Items {
+			entries = append(entries, change.Type+" "+change.ID)
+		}
+		return entries
+	}
+
+	first := changes("")
+	if got, want := summary(first), []string{"created " + alice.ID, "created " + bob.ID, "created " + admin.ID}; !slices.Equal(got, want) {
+		t.Errorf("the whole feed is %v, want %v", got, want)
+	}
+
+	bob.LastName = "Builder"
+	if err := app.Models.User.Update(*bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Models.User.Delete(alice.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// both changes may be stamped in the same microsecond, which leaves their order to
+	// the ids
+	second := changes(first.NextCursor)
+	got, want := summary(second), []string{"deleted " + alice.ID, "updated " + bob.ID}
+	if slices.Sort(got); !slices.Equal(got, want) {
+		t.Errorf("the feed since the first batch is %v, want %v", got, want)
+	}
+	for _, change := range second.Items {
+		if (change.Type == data.ChangeDeleted) != (change.Employee == nil) || change.Employee != nil && change.Employee.LastName != "Builder" {
+			t.Errorf("the %s change carries %+v", change.Type, change.Employee)
+		}
+	}
+
+	// changes within the lag wait until the writes stamped before them have committed
+	app.ChangeFeedLag = time.Hour
+	addUser(t, app, "carol@example.com", time.Now())
+
+	third := changes(second.NextCursor)
+	if len(third.Items) != 0 || third.HasMore || third.NextCursor != second.NextCursor {
+		t.Errorf("the feed within the lag is %v, next_cursor %q, want nothing and the same cursor", summary(third), third.NextCursor)
+	}
+
+	w := request(app, http.MethodGet, employeesPath+"/changes?since=nope", defaultAdminEmail, "", "", nil)
+	if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidCursor {
+		t.Errorf("since=nope: code %q, want %q", problem.Code, codeInvalidCursor)
+	}
+}
+
+func TestEmployeeChangesAfterPurge(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now().Add(-3*time.Hour))
+	addUser(t, app, "bob@example.com", time.Now().Add(-2*time.Hour))
+
+	w := request(app, http.MethodGet, employeesPath+"/changes?limit=1", defaultAdminEmail, "", "", nil)
+	old := decode[pagination.Page[EmployeeChange]](t, w, http.StatusOK)
+
+	if err := app.Models.User.Delete(alice.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Models.User.Purge(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	w = request(app, http.MethodGet, employeesPath+"/changes", defaultAdminEmail, "", "", nil)
+	for _, change := range decode[pagination.Page[EmployeeChange]](t, w, http.StatusOK).Items {
+		if change.ID == alice.ID {
+			t.Errorf("the feed still has a %s change of the purged employee", change.Type)
+		}
+	}
+
+	// the tombstones of deletions past the retention are gone, so is any position before
+	app.DeletedRetention = time.Hour
+	w = request(app, http.MethodGet, employeesPath+"/changes?since="+old.NextCursor, defaultAdminEmail, "", "", nil)
+	if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidCursor {
+		t.Errorf("a position past the retention: code %q, want %q", problem.Code, codeInvalidCursor)
+	}
+}
+
+func TestListEmployeesSnapshot(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now().Add(-time.Minute))
+	addUser(t, app, "bob@example.com", time.Now().Add(-time.Minute))
+
+	w := request(app, http.MethodGet, employeesPath+"?snapshot=true&sort=last_name", defaultAdminEmail, "", "", nil)
+	if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidParameter {
+		t.Errorf("snapshot sorted by last_name: code %q, want %q", problem.Code, codeInvalidParameter)
+	}
+
+	w = request(app, http.MethodGet, employeesPath+"?snapshot=true&limit=1", defaultAdminEmail, "", "", nil)
+	first := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+	// users deleted while the snapshot is traversed stay in it, new ones stay out
+	if err := app.Models.User.Delete(alice.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	addUser(t, app, "carol@example.com", time.Now().Add(time.Second))
+
+	listed := ids(first.Items)
+	for cursor := first.NextCursor; cursor != ""; {
+		w := request(app, http.MethodGet, employeesPath+"?snapshot=true&limit=1&cursor="+cursor, defaultAdminEmail, "", "", nil)
+		page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+		listed = append(listed, ids(page.Items)...)
+		cursor = page.NextCursor
+	}
+
+	if len(listed) != 3 || !slices.Contains(listed, alice.ID) {
+		t.Errorf("the snapshot lists %v, want the admin, alice and bob", listed)
+	}
+}
+
+func TestCreateEmployeeReportsEveryFieldError(t *testing.T) {
+	app := newTestApp(t)
+
+	body := `{"email":"nope","foo":1,"id":"x","first_name":5}`
+	w := request(app, http.MethodPost, employeesPath, defaultAdminEmail, "application/json", body, nil)
+	problem := decode[testProblem](t, w, http.StatusUnprocessableEntity)
+
+	want := []string{"email", "first_name", "foo", "id", "password"}
+	if got := problem.fields(); !slices.Equal(got, want) {
+		t.Errorf("field errors for %v, want %v", got, want)
+	}
+
+	for _, body := range []string{`[]`, `null`, `{"email":`, `{} {}`} {
+		w := request(app, http.MethodPost, employeesPath, defaultAdminEmail, "application/json", body, nil)
+		if problem := decode[testProblem](t, w, http.StatusBadRequest); problem.Code != codeInvalidJSON {
+			t.Errorf("%s: code %q, want %q", body, problem.Code, codeInvalidJSON)
+		}
+	}
+}
+
+func TestCreateEmployee(t *testing.T) {
+	app := newTestApp(t)
+
+	body := `{"email":"new@example.com","first_name":"New","last_name":"Hire","password":"secret123","user_active":true}`
+	w := request(app, http.MethodPost, employeesPath, defaultAdminEmail, "application/json", body, nil)
+	created := decode[EmployeeView](t, w, http.StatusCreated)
+
+	if location := w.Header().Get("Location"); location != employeeURL(created.ID) {
+		t.Errorf("Location = %q, want %q", location, employeeURL(created.ID))
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("ETag = %q, want %q", etag, `"1"`)
+	}
+
+	w = request(app, http.MethodGet, employeeURL(created.ID), defaultAdminEmail, "", "", nil)
+	got := decode[EmployeeView](t, w, http.StatusOK)
+	if got.Email != "new@example.com" || got.FirstName != "New" || got.LastName != "Hire" || !got.Active {
+		t.Errorf("GET returned %+v", got)
+	}
+
+	w = request(app, http.MethodPost, employeesPath, defaultAdminEmail, "application/json", body, nil)
+	if problem := decode[testProblem](t, w, http.StatusConflict); problem.Code != codeConflict {
+		t.Errorf("duplicate email: code %q, want %q", problem.Code, codeConflict)
+	}
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now())
+
+	w := request(app, http.MethodGet, "/get-employee/"+alice.ID, defaultAdminEmail, "", "", nil)
+	if employee := decode[EmployeeView](t, w, http.StatusOK); employee.ID != alice.ID {
+		t.Errorf("the legacy route returned %+v", employee)
+	}
+
+	if deprecation := w.Header().Get("Deprecation"); deprecation != fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()) {
+		t.Errorf("Deprecation = %q", deprecation)
+	}
+	if sunset := w.Header().Get("Sunset"); sunset != defaultLegacySunset.Format(http.TimeFormat) {
+		t.Errorf("Sunset = %q", sunset)
+	}
+	if link, want := w.Header().Get("Link"), fmt.Sprintf(`<%s>; rel="successor-version"`, employeeURL(alice.ID)); link != want {
+		t.Errorf("Link = %q, want %q", link, want)
+	}
+}
+
+func TestDeleteAndRestoreEmployee(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now())
+	bob := addUser(t, app, "bob@example.com", time.Now())
+
+	w := request(app, http.MethodDelete, employeeURL(bob.ID), alice.Email, "", "", nil)
+	decode[testProblem](t, w, http.StatusForbidden)
+
+	w = request(app, http.MethodDelete, employeeURL(bob.ID), bob.Email, "", "", nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("deleting themselves: %d %s", w.Code, w.Body)
+	}
+
+	w = request(app, http.MethodGet, employeeURL(bob.ID), defaultAdminEmail, "", "", nil)
+	decode[testProblem](t, w, http.StatusNotFound)
+
+	w = request(app, http.MethodGet, employeesPath, defaultAdminEmail, "", "", nil)
+	if listed := ids(decode[pagination.Page[EmployeeView]](t, w, http.StatusOK).Items); slices.Contains(listed, bob.ID) {
+		t.Errorf("a deleted employee is listed")
+	}
+
+	w = request(app, http.MethodGet, employeesPath+"?include_deleted=true&page=1", defaultAdminEmail, "", "", nil)
+	page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+	i := slices.IndexFunc(page.Items, func(e EmployeeView) bool { return e.ID == bob.ID })
+	if i < 0 || page.Items[i].DeletedAt == nil || *page.TotalCount != 3 {
+		t.Errorf("include_deleted lists %+v", page.Items)
+	}
+
+	w = request(app, http.MethodPost, employeeURL(bob.ID)+"/restore", alice.Email, "", "", nil)
+	decode[testProblem](t, w, http.StatusForbidden)
+
+	w = request(app, http.MethodPost, employeeURL(bob.ID)+"/restore", defaultAdminEmail, "", "", nil)
+	if restored := decode[EmployeeView](t, w, http.StatusOK); restored.DeletedAt != nil || restored.Version != 2 {
+		t.Errorf("restored %+v", restored)
+	}
+
+	w = request(app, http.MethodGet, employeeURL(bob.ID), bob.Email, "", "", nil)
+	decode[EmployeeView](t, w, http.StatusOK)
+
+	w = request(app, http.MethodPost, employeeURL(data.NewUUID())+"/restore", defaultAdminEmail, "", "", nil)
+	decode[testProblem](t, w, http.StatusNotFound)
+}
@@ -3,50 +3,164 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/validation"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-type jsonResponse struct {
-	Error   bool   `json:"error"`
-	Message string `json:"message"`
-	Data    any    `json:"data,omitempty"`
-}
+// maxJSONBytes is one megabyte; limitation on the size of uploaded json file
+const maxJSONBytes = 1048576
 
+// readJSON decodes the JSON body of the request into data, see decodeJSON.
 func (app *Config) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
-	maxByte := 1048576 // one megabyte; limitation on the size of uploaded json file
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
 
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxByte))
+	return decodeJSON(r.Body, data)
+}
 
-	dec := json.NewDecoder(r.Body)
-	err := dec.Decode(data)
-	if err != nil {
-		return err
+// decodeJSON decodes a JSON object into data, a pointer to a struct, refusing fields
+// data doesn't have, and then checks data against its validate tags. Unknown fields,
+// values of the wrong type and broken rules are all returned together as
+// validation.Errors, which problem turns into a 422; a body that isn't a JSON object is
+// a 400.
+func decodeJSON(body io.Reader, data any) error {
+	dec := json.NewDecoder(body)
+
+	var members map[string]json.RawMessage
+	err := dec.Decode(&members)
+	if err != nil || members == nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) || err == nil {
+			return errBadRequest(codeInvalidJSON, "the body must be a JSON object")
+		}
+		return &apiError{status: http.StatusBadRequest, code: codeInvalidJSON, detail: "the body isn't valid JSON", err: err}
 	}
 
 	// check there is only a single JSON value in the file
 	// that i received
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must have only a single JSON value")
+		return errBadRequest(codeInvalidJSON, "the body must have only a single JSON value")
+	}
+
+	// each member is decoded on its own, so a decoding error doesn't hide the ones after
+	// it, and the rules are checked too, to report as many errors at once as possible
+	value := reflect.ValueOf(data).Elem()
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs validation.Errors
+	for _, name := range names {
+		field, ok := jsonField(value, name)
+		if !ok {
+			errs = append(errs, validation.FieldError{
+				Field:   name,
+				Code:    validation.CodeUnknownField,
+				Message: "is not a known field",
+			})
+			continue
+		}
+
+		var typeErr *json.UnmarshalTypeError
+		err := json.Unmarshal(members[name], field.Addr().Interface())
+		switch {
+		case err == nil:
+		case errors.As(err, &typeErr):
+			errs = append(errs, validation.FieldError{
+				Field:   name,
+				Code:    validation.CodeInvalidType,
+				Message: fmt.Sprintf("must be a %s", jsonType(field.Type())),
+			})
+		default:
+			return &apiError{status: http.StatusBadRequest, code: codeInvalidJSON, detail: "the body isn't valid JSON", err: err}
+		}
+	}
+
+	errs = append(errs, validation.Struct(data)...)
+	if len(errs) > 0 {
+		return errs
 	}
 
 	return nil
 }
 
+// jsonField returns the field of a struct a JSON member is decoded into, matching names
+// like encoding/json does: exactly if possible, otherwise ignoring case.
+func jsonField(value reflect.Value, name string) (reflect.Value, bool) {
+	folded := -1
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		fieldName := validation.FieldName(field)
+		if fieldName == name {
+			return value.Field(i), true
+		}
+		if folded < 0 && strings.EqualFold(fieldName, name) {
+			folded = i
+		}
+	}
+
+	if folded < 0 {
+		return reflect.Value{}, false
+	}
+
+	return value.Field(folded), true
+}
+
+// jsonType returns the JSON name of the type a Go type is decoded from.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
 func (app *Config) writeJSON(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
 	out, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
+	// the headers are added to the ones already set, e.g. a Link to those of Deprecated
 	if len(headers) > 0 {
 		for key, val := range headers[0] {
-			w.Header()[key] = val
+			w.Header()[key] = append(w.Header()[key], val...)
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	// problems come with their own media type
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(status)
 	_, err = w.Write(out)
 	if err != nil {
@@ -56,17 +170,55 @@ func (app *Config) writeJSON(w http.ResponseWriter, status int, data any, header
 	return nil
 }
 
-func (app *Config) errorJSON(w http.ResponseWriter, err error, status ...int) error {
-	// default statuscode if not specified
-	statuscode := http.StatusBadRequest
+// readFilter reads the employee listing filters from the query string:
+// user_active, email_domain, name_prefix, created_after, created_before, updated_after,
+// updated_before, q and include_deleted. Times are RFC 3339 timestamps or plain dates.
+func (app *Config) readFilter(query url.Values) (data.Filter, error) {
+	var filter data.Filter
 
-	if len(status) > 0 {
-		statuscode = status[0]
+	if value := query.Get("user_active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("user_active must be true or false, got %q", value)
+		}
+		filter.Active = &active
 	}
 
-	var payload jsonResponse
-	payload.Error = true
-	payload.Message = err.Error()
+	if value := query.Get("include_deleted"); value != "" {
+		includeDeleted, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("include_deleted must be true or false, got %q", value)
+		}
+		filter.IncludeDeleted = includeDeleted
+	}
+
+	filter.EmailDomain = strings.TrimPrefix(strings.TrimSpace(query.Get("email_domain")), "@")
+	filter.NamePrefix = strings.TrimSpace(query.Get("name_prefix"))
+	filter.Query = strings.TrimSpace(query.Get("q"))
+
+	for _, bound := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, value)
+		}
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or a date, got %q", bound.name, value)
+		}
+		*bound.dst = &t
+	}
 
-	return app.writeJSON(w, statuscode, payload)
+	return filter, nil
 }
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/validation"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxImportBytes and maxImportRows bound the size of one bulk import.
+const (
+	maxImportBytes = 16 << 20
+	maxImportRows  = 10000
+)
+
+// The statuses of the rows of an import report.
+const (
+	importCreated   = "created"
+	importDuplicate = "duplicate"
+	importInvalid   = "invalid"
+	// importSkipped rows were valid, but not inserted because all_or_nothing was set and
+	// another row was not
+	importSkipped = "skipped"
+)
+
+// importRow is one employee of an import, as a CSV record or an NDJSON line.
+type importRow struct {
+	Email     string `json:"email" validate:"required,email,max=50"`
+	FirstName string `json:"first_name" validate:"max=50"`
+	LastName  string `json:"last_name" validate:"max=50"`
+	Password  string `json:"password" validate:"required,password"`
+	// Active is a pointer so a missing user_active can mean active
+	Active *bool `json:"user_active"`
+}
+
+// importResult is the outcome of one row of an import. Invalid rows list their field
+// errors, the same ones CreateEmployee responds with.
+type importResult struct {
+	Row    int               `json:"row"`
+	Email  string            `json:"email,omitempty"`
+	Status string            `json:"status"`
+	ID     string            `json:"id,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// importReport is the response of an import.
+type importReport struct {
+	Created   int            `json:"created"`
+	Duplicate int            `json:"duplicate"`
+	Invalid   int            `json:"invalid"`
+	Committed bool           `json:"committed"`
+	Rows      []importResult `json:"rows"`
+}
+
+// ImportEmployees creates employees in bulk from a CSV file with a header line, or from
+// NDJSON with one employee object per line, picked by the Content-Type (text/csv or
+// application/x-ndjson) or ?format=csv|ndjson. The columns are email, first_name,
+// last_name, password and user_active, which defaults to true.
+//
+// Every row is validated and reported as created, duplicate (the email is taken, or
+// repeated in the file) or invalid. Valid rows are inserted in one transaction, and the
+// report comes back with 201 when some were, 200 otherwise. With ?all_or_nothing=true
+// none are inserted unless all of them can be, and the report comes back with 422.
+func (app *Config) ImportEmployees(w http.ResponseWriter, r *http.Request) {
+	allOrNothing := false
+	if value := r.URL.Query().Get("all_or_nothing"); value != "" {
+		var err error
+		allOrNothing, err = strconv.ParseBool(value)
+		if err != nil {
+			app.problem(w, r, errInvalidParameter(fmt.Errorf("all_or_nothing must be true or false, got %q", value)))
+			return
+		}
+	}
+
+	format, err := importFormat(r)
+	if err != nil {
+		app.problem(w, r, &apiError{status: http.StatusUnsupportedMediaType, code: codeUnsupportedMediaType, detail: err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []importRow
+	var results []importResult
+	if format == "csv" {
+		rows, results, err = readImportCSV(body)
+	} else {
+		rows, results, err = readImportNDJSON(body)
+	}
+	if err != nil {
+		app.problem(w, r, errBadRequest(codeBadRequest, err.Error()))
+		return
+	}
+
+	report := importReport{Rows: results}
+	validateImport(rows, report.Rows)
+
+	// an import all or nothing with an invalid row inserts none, so its passwords aren't
+	// worth hashing
+	invalid := slices.ContainsFunc(report.Rows, func(result importResult) bool { return result.Status != "" })
+	users := make([]data.User, len(rows))
+	if !allOrNothing || !invalid {
+		users = hashImport(rows, report.Rows)
+	}
+
+	// only the valid rows go to the database
+	var valid []int
+	var batch []data.User
+	for i := range report.Rows {
+		if report.Rows[i].Status == "" {
+			valid = append(valid, i)
+			batch = append(batch, users[i])
+		}
+	}
+
+	invalid = len(valid) < len(report.Rows)
+	if allOrNothing && invalid {
+		batch = nil
+	}
+
+	var duplicates []bool
+	if len(batch) > 0 {
+		duplicates, err = app.Models.User.Import(batch, allOrNothing)
+		if err != nil {
+			app.problem(w, r, errInternal("couldn't import records to db", err))
+			return
+		}
+	}
+
+	rejected := invalid
+	for _, duplicate := range duplicates {
+		rejected = rejected || duplicate
+	}
+	report.Committed = !(allOrNothing && rejected) && len(batch) > 0
+
+	for n, i := range valid {
+		result := &report.Rows[i]
+		switch {
+		case n < len(duplicates) && duplicates[n]:
+			result.Status = importDuplicate
+			result.Error = "email already exists"
+		case report.Committed:
+			result.Status = importCreated
+			result.ID = users[i].ID
+		default:
+			result.Status = importSkipped
+		}
+	}
+
+	for _, result := range report.Rows {
+		switch result.Status {
+		case importCreated:
+			report.Created++
+		case importDuplicate:
+			report.Duplicate++
+		case importInvalid:
+			report.Invalid++
+		}
+	}
+
+	status := http.StatusOK
+	switch {
+	case allOrNothing && rejected:
+		status = http.StatusUnprocessableEntity
+	case report.Created > 0:
+		status = http.StatusCreated
+	}
+
+	app.writeJSON(w, status, report)
+}
+
+// importFormat returns "csv" or "ndjson", from ?format or else the Content-Type.
+func importFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format != "csv" && format != "ndjson" {
+			return "", fmt.Errorf("format must be csv or ndjson, got %q", format)
+		}
+		return format, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return "csv", nil
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return "ndjson", nil
+	default:
+		return "", errors.New("send text/csv or application/x-ndjson, or set ?format=csv|ndjson")
+	}
+}
+
+// readImportCSV reads the rows of a CSV import. Records that don't fit the header are
+// reported as invalid; a file that isn't CSV at all is an error.
+func readImportCSV(body io.Reader) ([]importRow, []importResult, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case "email", "first_name", "last_name", "password", "user_active":
+			columns[name] = i
+		default:
+			return nil, nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, nil, errors.New("the CSV header has no email column")
+	}
+
+	// passwords are taken as they are, spaces included
+	raw := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	field := func(record []string, name string) string {
+		return strings.TrimSpace(raw(record, name))
+	}
+
+	var rows []importRow
+	var results []importResult
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, nil, fmt.Errorf("an import can have at most %d rows", maxImportRows)
+		}
+
+		row := importRow{
+			Email:     field(record, "email"),
+			FirstName: field(record, "first_name"),
+			LastName:  field(record, "last_name"),
+			Password:  raw(record, "password"),
+		}
+		result := importResult{Row: len(rows) + 1, Email: row.Email}
+
+		if len(record) != len(header) {
+			result.Status = importInvalid
+			result.Error = fmt.Sprintf("expected %d fields, got %d", len(header), len(record))
+		} else if value := field(record, "user_active"); value != "" {
+			active, err := strconv.ParseBool(value)
+			if err != nil {
+				result.Status = importInvalid
+				result.Error = fmt.Sprintf("user_active must be true or false, got %q", value)
+			}
+			row.Active = &active
+		}
+
+		rows = append(rows, row)
+		results = append(results, result)
+	}
+
+	return rows, results, nil
+}
+
+// readImportNDJSON reads the rows of an NDJSON import, skipping blank lines. Lines that
+// aren't an employee object are reported as invalid.
+func readImportNDJSON(body io.Reader) ([]importRow, []importResult, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBytes)
+
+	var rows []importRow
+	var results []importResult
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, nil, fmt.Errorf("an import can have at most %d rows", maxImportRows)
+		}
+
+		var row importRow
+		result := importResult{Row: len(rows) + 1}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row); err != nil {
+			result.Status = importInvalid
+			result.Error = fmt.Sprintf("invalid JSON: %v", err)
+		}
+		row.Email = strings.TrimSpace(row.Email)
+		result.Email = row.Email
+
+		rows = append(rows, row)
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("invalid NDJSON: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("the NDJSON file is empty")
+	}
+
+	return rows, results, nil
+}
+
+// validateImport marks the rows breaking the rules of importRow as invalid, and the
+// repeated emails of the file as duplicates.
+func validateImport(rows []importRow, results []importResult) {
+	seen := map[string]bool{}
+
+	for i, row := range rows {
+		if results[i].Status != "" {
+			continue
+		}
+
+		if errs := validation.Struct(row); errs != nil {
+			results[i].Status = importInvalid
+			results[i].Error = errs.Error()
+			results[i].Errors = errs
+			continue
+		}
+
+		if seen[row.Email] {
+			results[i].Status = importDuplicate
+			results[i].Error = "email is repeated in the file"
+			continue
+		}
+		seen[row.Email] = true
+	}
+}
+
+// hashImport turns the rows still without a status into users, hashing their passwords
+// in a pool of one worker per CPU, since bcrypt is slow on purpose.
+func hashImport(rows []importRow, results []importResult) []data.User {
+	users := make([]data.User, len(rows))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hashedPassword, err := data.HashPassword(rows[i].Password)
+				if err != nil {
+					results[i].Status = importInvalid
+					results[i].Error = fmt.Sprintf("can't hash password: %v", err)
+					continue
+				}
+				users[i].Password = string(hashedPassword)
+			}
+		}()
+	}
+
+	for i, row := range rows {
+		if results[i].Status != "" {
+			continue
+		}
+
+		active := true
+		if row.Active != nil {
+			active = *row.Active
+		}
+		users[i] = data.User{
+			ID:        data.NewUUID(),
+			Email:     row.Email,
+			FirstName: row.FirstName,
+			LastName:  row.LastName,
+			Active:    active,
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return users
+}
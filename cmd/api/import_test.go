@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportEmployees(t *testing.T) {
+	app := newTestApp(t)
+	addUser(t, app, "alice@example.com", time.Now())
+	before := time.Now().Add(-time.Millisecond)
+
+	csv := "email,first_name,last_name,password,user_active\n" +
+		"bob@example.com,Bob,Builder,secret123,false\n" +
+		"alice@example.com,Alice,Again,secret123,true\n" +
+		"not an email,Carol,Nobody,secret123,true\n" +
+		"bob@example.com,Bob,Twice,secret123,true\n"
+
+	w := request(app, http.MethodPost, employeesPath+"/import", defaultAdminEmail, "text/csv", csv, nil)
+	report := decode[importReport](t, w, http.StatusCreated)
+
+	if report.Created != 1 || report.Duplicate != 2 || report.Invalid != 1 || !report.Committed {
+		t.Errorf("the import created %d, found %d duplicates and %d invalid rows, committed %v", report.Created, report.Duplicate, report.Invalid, report.Committed)
+	}
+	for i, want := range []string{importCreated, importDuplicate, importInvalid, importDuplicate} {
+		if report.Rows[i].Status != want {
+			t.Errorf("row %d is %s, want %s", i+1, report.Rows[i].Status, want)
+		}
+	}
+	if errs := report.Rows[2].Errors; len(errs) != 1 || errs[0].Field != "email" {
+		t.Errorf("the invalid row has the errors %+v", errs)
+	}
+
+	bob, err := app.Models.User.GetByEmail("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.ID != report.Rows[0].ID || bob.Active || bob.CreatedAt.Before(before) {
+		t.Errorf("the imported employee is %+v, want the one of row 1, inactive and created by the import", bob)
+	}
+	if matches, _ := bob.PasswordMatches("secret123"); !matches {
+		t.Error("the imported employee doesn't have the password of its row")
+	}
+
+	// nothing left to create
+	w = request(app, http.MethodPost, employeesPath+"/import?format=ndjson", defaultAdminEmail, "", `{"email":"bob@example.com","password":"secret123"}`, nil)
+	if report := decode[importReport](t, w, http.StatusOK); report.Created != 0 || report.Duplicate != 1 {
+		t.Errorf("importing bob again created %d and found %d duplicates", report.Created, report.Duplicate)
+	}
+}
+
+func TestImportEmployeesAllOrNothing(t *testing.T) {
+	app := newTestApp(t)
+
+	ndjson := `{"email":"carol@example.com","first_name":"Carol","password":"secret123"}
+{"email":"dave@example.com","password":"short"}
+`
+	w := request(app, http.MethodPost, employeesPath+"/import?all_or_nothing=true", defaultAdminEmail, "application/x-ndjson", ndjson, nil)
+	report := decode[importReport](t, w, http.StatusUnprocessableEntity)
+
+	if report.Committed || report.Rows[0].Status != importSkipped || report.Rows[1].Status != importInvalid {
+		t.Errorf("the failed import reports %+v", report)
+	}
+	if _, err := app.Models.User.GetByEmail("carol@example.com"); err == nil {
+		t.Error("the valid row of a failed import all or nothing was inserted")
+	}
+
+	valid, _, _ := strings.Cut(ndjson, "\n")
+	w = request(app, http.MethodPost, employeesPath+"/import?all_or_nothing=true", defaultAdminEmail, "application/x-ndjson", valid, nil)
+	if report := decode[importReport](t, w, http.StatusCreated); report.Created != 1 || !report.Committed {
+		t.Errorf("the import of the valid row reports %+v", report)
+	}
+}
+
+func TestImportEmployeesRefusesBadFiles(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"unknown format", "application/json", `[]`, http.StatusUnsupportedMediaType, codeUnsupportedMediaType},
+		{"empty CSV", "text/csv", "", http.StatusBadRequest, codeBadRequest},
+		{"unknown column", "text/csv", "email,salary\n", http.StatusBadRequest, codeBadRequest},
+		{"no email column", "text/csv", "first_name\nAda\n", http.StatusBadRequest, codeBadRequest},
+	}
+
+	for _, tt := range tests {
+		w := request(app, http.MethodPost, employeesPath+"/import", defaultAdminEmail, tt.contentType, tt.body, nil)
+		if problem := decode[testProblem](t, w, tt.status); problem.Code != tt.code {
+			t.Errorf("%s: code %q, want %q", tt.name, problem.Code, tt.code)
+		}
+	}
+}
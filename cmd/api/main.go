@@ -1,13 +1,16 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"fmt"
 
 	// "log"
 	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	_ "github.com/jackc/pgconn"
@@ -19,11 +22,69 @@ import (
 
 const webPort = "80"
 
+// defaultPageLimit is the page size of the listings when none is given.
+const defaultPageLimit = 10
+
+// defaultCountCacheTTL is how long a total count is reused for the same filter, unless
+// COUNT_CACHE_TTL is set in the environment.
+const defaultCountCacheTTL = 30 * time.Second
+
+// defaultMaxPageLimit is the largest page size accepted by the paginated endpoints,
+// unless MAX_PAGE_LIMIT is set in the environment.
+const defaultMaxPageLimit = 100
+
+// defaultSQLitePath is the database file of STORAGE=sqlite, unless SQLITE_PATH is set in
+// the environment.
+const defaultSQLitePath = "restApiWithPagination.db"
+
+// legacyDeprecatedAt is when the routes from before /v1 were deprecated.
+var legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// defaultLegacySunset is when the routes from before /v1 stop working, unless
+// LEGACY_SUNSET is set in the environment.
+var defaultLegacySunset = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+
+// defaultAdminEmail is the email of the admin, unless ADMIN_EMAIL is set in the
+// environment. It is the admin DatabaseQuery.SQL creates.
+const defaultAdminEmail = "admin@example.com"
+
+// defaultDeletedRetention is how long deleted employees can be restored before the
+// purge job removes them, unless DELETED_RETENTION is set in the environment.
+const defaultDeletedRetention = 30 * 24 * time.Hour
+
+// defaultPurgeInterval is how often the purge job runs, unless PURGE_INTERVAL is set in
+// the environment.
+const defaultPurgeInterval = time.Hour
+
+// defaultChangeFeedLag is how far behind the present the change feed stays, unless
+// CHANGE_FEED_LAG is set in the environment. It has to outlast the writes to users,
+// which time out after 3 seconds, with some room for the clocks of the replicas.
+const defaultChangeFeedLag = 10 * time.Second
+
 var counts int64
 
 type Config struct {
-	DB     *sql.DB
-	Models data.Models
+	DB           *sql.DB
+	Models       data.Models
+	MaxPageLimit int
+	Cursors      pagination.Codec
+	Counts       *pagination.CountCache
+	// Migrator is nil for the storages without a schema
+	Migrator *data.Migrator
+	// LegacySunset is announced by the routes from before /v1 as their end of life
+	LegacySunset time.Time
+	// RequireIfMatch refuses changes to an employee that don't say which version they
+	// change
+	RequireIfMatch bool
+	// AdminEmail is the email of the user allowed to delete and restore other employees
+	AdminEmail string
+	// DeletedRetention is how long deleted employees are kept, 0 keeps them forever
+	DeletedRetention time.Duration
+	// PurgeInterval is how often deleted employees past DeletedRetention are purged
+	PurgeInterval time.Duration
+	// ChangeFeedLag keeps the most recent changes out of the change feed until the
+	// writes stamped before them have committed
+	ChangeFeedLag time.Duration
 }
 
 func main() {
@@ -36,23 +97,68 @@ func main() {
 		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
 		0664,
 	)
+
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
 	// Then, set up the multi logger with multiwriter. Here, one looger for file another for std output(console)
-	multi := zerolog.MultiLevelWriter(os.Stdout, logFile)
+	// The other commands print their results to stdout, e.g. the SQL of migrate -dry-run
+	// to pipe into psql, so their logs go to stderr instead.
+	console := os.Stdout
+	if command != "serve" {
+		console = os.Stderr
+	}
+	multi := zerolog.MultiLevelWriter(console, logFile)
 	// Then, include timestamp with the loggers
 	log.Logger = zerolog.New(multi).With().Timestamp().Logger()
 
 	log.Info().Msg("Application is starting...")
 	// log.Println("Starting authentication service")
 
-	// connect to DB
-	conn := connectToDB()
-	if conn == nil {
-		log.Panic().Msg("Can't connect to Postgres!")
-	}
 	// Set up config
 	app := Config{
-		DB:     conn,
-		Models: data.New(conn),
+		MaxPageLimit:     maxPageLimit(),
+		Cursors:          pagination.Codec{Key: cursorKey(), TTL: cursorTTL()},
+		Counts:           pagination.NewCountCache(countCacheTTL()),
+		LegacySunset:     legacySunset(),
+		RequireIfMatch:   requireIfMatch(),
+		AdminEmail:       adminEmail(),
+		DeletedRetention: durationEnv("DELETED_RETENTION", defaultDeletedRetention),
+		PurgeInterval:    durationEnv("PURGE_INTERVAL", defaultPurgeInterval),
+		ChangeFeedLag:    durationEnv("CHANGE_FEED_LAG", defaultChangeFeedLag),
+	}
+
+	if command == "help" || command == "-h" || command == "--help" {
+		fmt.Print(usage)
+		return
+	}
+
+	run, ok := commands[command]
+	if command != "serve" && !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	app.openStorage()
+
+	if command != "serve" {
+		os.Exit(run(&app, args))
+	}
+
+	app.serve()
+}
+
+// serve applies the pending migrations, unless MIGRATE_ON_START=false, starts the purge
+// of deleted employees, unless DELETED_RETENTION=0, and serves the API.
+func (app *Config) serve() {
+	if app.Migrator != nil && migrateOnStart() {
+		app.migrateUp()
+	}
+
+	if app.DeletedRetention > 0 && app.PurgeInterval > 0 {
+		go app.purgeDeleted()
 	}
 
 	srv := &http.Server{
@@ -67,7 +173,47 @@ func main() {
 	if err != nil {
 		log.Panic().Msg(err.Error())
 	}
+}
+
+// openStorage connects to the storage picked by STORAGE, postgres unless it says
+// otherwise.
+func (app *Config) openStorage() {
+	var err error
+
+	switch storage := os.Getenv("STORAGE"); storage {
+	case "", "postgres":
+		// connect to DB
+		conn := connectToDB()
+		if conn == nil {
+			log.Panic().Msg("Can't connect to Postgres!")
+		}
+		app.DB = conn
+		app.Models = data.New(conn)
+		app.Migrator, err = data.NewPostgresMigrator(conn)
+	case "memory":
+		log.Info().Msg("Storing users in memory, they are lost on restart")
+		app.Models = data.NewMemory()
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		var conn *sql.DB
+		conn, err = data.OpenSQLite(path)
+		if err != nil {
+			log.Panic().Msgf("Can't open sqlite database %s: %v", path, err)
+		}
+		log.Info().Msgf("Storing users in sqlite database %s", path)
+		app.DB = conn
+		app.Models = data.NewSQLite(conn)
+		app.Migrator, err = data.NewSQLiteMigrator(conn)
+	default:
+		log.Panic().Msgf("Unknown STORAGE %q, use postgres, sqlite or memory", storage)
+	}
 
+	if err != nil {
+		log.Panic().Msgf("Can't load the migrations: %v", err)
+	}
 }
 
 func openDB(dsn string) (*sql.DB, error) {
@@ -110,3 +256,150 @@ func connectToDB() *sql.DB {
 		continue
 	}
 }
+
+// maxPageLimit reads the largest allowed page size from MAX_PAGE_LIMIT, falling back
+// to defaultMaxPageLimit when it is unset or not a positive number.
+func maxPageLimit() int {
+	value := os.Getenv("MAX_PAGE_LIMIT")
+	if value == "" {
+		return defaultMaxPageLimit
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		log.Info().Msgf("Ignoring invalid MAX_PAGE_LIMIT %q, using %d", value, defaultMaxPageLimit)
+		return defaultMaxPageLimit
+	}
+
+	return limit
+}
+
+// cursorKey returns the HMAC key pagination cursors are signed with, taken from
+// CURSOR_SECRET. Without it a random key is generated, which means cursors stop working
+// after a restart and aren't shared between replicas.
+func cursorKey() []byte {
+	if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Warn().Msg("CURSOR_SECRET is not set, signing cursors with a random key")
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Panic().Msgf("can't generate cursor key: %v", err)
+	}
+
+	return key
+}
+
+// cursorTTL reads how long pagination cursors stay valid from CURSOR_TTL (e.g. "1h").
+// Cursors don't expire when it's unset.
+func cursorTTL() time.Duration {
+	value := os.Getenv("CURSOR_TTL")
+	if value == "" {
+		return 0
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Info().Msgf("Ignoring invalid CURSOR_TTL %q, cursors won't expire", value)
+		return 0
+	}
+
+	return ttl
+}
+
+// countCacheTTL reads how long total counts are cached from COUNT_CACHE_TTL (e.g. "1m"),
+// falling back to defaultCountCacheTTL.
+func countCacheTTL() time.Duration {
+	value := os.Getenv("COUNT_CACHE_TTL")
+	if value == "" {
+		return defaultCountCacheTTL
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Info().Msgf("Ignoring invalid COUNT_CACHE_TTL %q, using %s", value, defaultCountCacheTTL)
+		return defaultCountCacheTTL
+	}
+
+	return ttl
+}
+
+// adminEmail reads the email of the admin from ADMIN_EMAIL, falling back to
+// defaultAdminEmail.
+func adminEmail() string {
+	if email := os.Getenv("ADMIN_EMAIL"); email != "" {
+		return email
+	}
+
+	return defaultAdminEmail
+}
+
+// durationEnv reads a duration like "720h" from the environment variable name, falling
+// back to fallback when it is unset or invalid.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Info().Msgf("Ignoring invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+
+	return d
+}
+
+// legacySunset reads when the routes from before /v1 stop working from LEGACY_SUNSET, a
+// date like 2027-04-30, falling back to defaultLegacySunset.
+func legacySunset() time.Time {
+	value := os.Getenv("LEGACY_SUNSET")
+	if value == "" {
+		return defaultLegacySunset
+	}
+
+	sunset, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		log.Info().Msgf("Ignoring invalid LEGACY_SUNSET %q, using %s", value, defaultLegacySunset.Format(time.DateOnly))
+		return defaultLegacySunset
+	}
+
+	return sunset
+}
+
+// requireIfMatch reports whether PUT, PATCH and DELETE of an employee need an If-Match
+// header, which REQUIRE_IF_MATCH=true turns on.
+func requireIfMatch() bool {
+	value := os.Getenv("REQUIRE_IF_MATCH")
+	if value == "" {
+		return false
+	}
+
+	required, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Info().Msgf("Ignoring invalid REQUIRE_IF_MATCH %q, If-Match stays optional", value)
+		return false
+	}
+
+	return required
+}
+
+// migrateOnStart reports whether pending migrations are applied when the API starts,
+// which MIGRATE_ON_START=false turns off.
+func migrateOnStart() bool {
+	value := os.Getenv("MIGRATE_ON_START")
+	if value == "" {
+		return true
+	}
+
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Info().Msgf("Ignoring invalid MIGRATE_ON_START %q, migrating", value)
+		return true
+	}
+
+	return on
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "secret123"
+
+// testHash is testPassword hashed at the lowest cost, so authenticating doesn't slow the
+// tests down.
+var testHash = func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+	return string(hash)
+}()
+
+// newTestApp returns the API backed by an empty memory storage, with the admin as its
+// only user.
+func newTestApp(t *testing.T) *Config {
+	t.Helper()
+
+	app := &Config{
+		Models:       data.NewMemory(),
+		MaxPageLimit: defaultMaxPageLimit,
+		Cursors:      pagination.Codec{Key: []byte("test-cursor-key")},
+		Counts:       pagination.NewCountCache(0),
+		LegacySunset: defaultLegacySunset,
+		AdminEmail:   defaultAdminEmail,
+	}
+	addUser(t, app, defaultAdminEmail, time.Now())
+
+	return app
+}
+
+// addUser stores an active user with testPassword, created at the given time.
+func addUser(t *testing.T, app *Config, email string, createdAt time.Time) *data.User {
+	t.Helper()
+
+	name, _, _ := strings.Cut(email, "@")
+	createdAt = createdAt.UTC().Truncate(time.Microsecond)
+
+	err := app.Models.User.BulkInsert([]data.User{{
+		ID:        data.NewUUID(),
+		Email:     email,
+		FirstName: name,
+		LastName:  name,
+		Password:  testHash,
+		Active:    true,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}})
+	if err != nil {
+		t.Fatalf("adding %s: %v", email, err)
+	}
+
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// request serves one request as the given user, with the body sent as contentType.
+func request(app *Config, method, target, user, contentType, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	if user != "" {
+		r.SetBasicAuth(user, testPassword)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	app.route().ServeHTTP(w, r)
+
+	return w
+}
+
+// decode decodes the body of a response, failing the test unless it has the status.
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder, status int) T {
+	t.Helper()
+
+	var v T
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+
+	return v
+}
+
+// testProblem is the part of a problem+json body the tests look at.
+type testProblem struct {
+	Code   string `json:"code"`
+	Errors []struct {
+		Field string `json:"field"`
+		Code  string `json:"code"`
+	} `json:"errors"`
+}
+
+// fields returns the fields of the field errors of a problem, sorted.
+func (p testProblem) fields() []string {
+	var fields []string
+	for _, err := range p.Errors {
+		fields = append(fields, err.Field)
+	}
+	slices.Sort(fields)
+
+	return fields
+}
+
+// walk follows the next cursors of a listing from its first page, and returns the ids
+// of every page.
+func walk(t *testing.T, app *Config, query url.Values) [][]string {
+	t.Helper()
+
+	var pages [][]string
+	for cursor := ""; ; {
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		w := request(app, http.MethodGet, employeesPath+"?"+query.Encode(), defaultAdminEmail, "", "", nil)
+		page := decode[pagination.Page[EmployeeView]](t, w, http.StatusOK)
+
+		pages = append(pages, ids(page.Items))
+
+		if page.NextCursor == "" {
+			return pages
+		}
+		cursor = page.NextCursor
+
+		if len(pages) > 100 {
+			t.Fatal("the listing doesn't end")
+		}
+	}
+}
+
+// ids returns the ids of the listed employees.
+func ids(employees []EmployeeView) []string {
+	var ids []string
+	for _, employee := range employees {
+		ids = append(ids, employee.ID)
+	}
+
+	return ids
+}
+
+func emails(employees []EmployeeView) []string {
+	var emails []string
+	for _, employee := range employees {
+		emails = append(emails, employee.Email)
+	}
+
+	return emails
+}
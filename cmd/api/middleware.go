@@ -2,11 +2,42 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"myRestAPIWithPagination/data"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog/log"
 )
 
+// EchoRequestID sends back the id middleware.RequestID gave the request, so clients can
+// quote it, and find it in problem responses and in the logs.
+func (app *Config) EchoRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Deprecated marks the responses of a route replaced by successor: the Deprecation
+// header (RFC 9745) says since when, Sunset (RFC 8594) until when it keeps working, and
+// Link points at the route to use instead. A {id} in successor is the id of the request.
+func (app *Config) Deprecated(successor string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			link := strings.ReplaceAll(successor, "{id}", url.PathEscape(chi.URLParam(r, "id")))
+
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()))
+			w.Header().Set("Sunset", app.LegacySunset.UTC().Format(http.TimeFormat))
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, link))
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
 // 👇 a logging middleware
 func (app *Config) Authenticate(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -24,21 +55,25 @@ func (app *Config) Authenticate(handler http.Handler) http.Handler {
 		// 	return
 		// }
 
-		log.Info().Msgf("Username:%s and Password:%s", username, password)
+		// the password is never logged
+		log.Info().Msgf("Username:%s", username)
 
 		if ok {
 			// validate the user against the database
 			user, err := app.Models.User.GetByEmail(username)
+			if errors.Is(err, data.ErrNotFound) {
+				app.problem(w, r, errUnauthorized("invalid credentials"))
+				return
+			}
 			if err != nil {
-				log.Info().Msgf("error while retrieving user from db: %v", err)
-				app.errorJSON(w, errors.New("invalid credentials: Username"), http.StatusBadRequest)
+				app.problem(w, r, errInternal("the credentials couldn't be checked", err))
 				return
 			}
 
 			// send errors for invalid users
 			valid, err := user.PasswordMatches(password)
 			if err != nil || !valid {
-				app.errorJSON(w, errors.New("invalid credentials: Password"), http.StatusBadRequest)
+				app.problem(w, r, errUnauthorized("invalid credentials"))
 				return
 			}
 
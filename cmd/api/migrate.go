@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"myRestAPIWithPagination/data"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migrateTimeout bounds a whole migration run, which can build indexes on large tables.
+const migrateTimeout = 10 * time.Minute
+
+// migrateUp applies the pending migrations at startup. Replicas starting together wait
+// for each other on the migration lock.
+func (app *Config) migrateUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	applied, err := app.Migrator.Up(ctx)
+	for _, migration := range applied {
+		log.Info().Msgf("Applied migration %s", migration)
+	}
+	if err != nil {
+		log.Panic().Msgf("Can't migrate the database: %v", err)
+	}
+}
+
+// migrateCommand runs "migrate [up|down|status] [flags]" and returns the exit code.
+// With -dry-run, up and down print the SQL they would run instead of running it.
+func (app *Config) migrateCommand(args []string) int {
+	if app.Migrator == nil {
+		fmt.Fprintln(os.Stderr, "migrate: this STORAGE has no schema to migrate")
+		return 1
+	}
+
+	command := "up"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the SQL of the migrations instead of running it")
+	steps := flags.Int("steps", 1, "number of migrations down reverts")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	var err error
+
+	switch command {
+	case "up":
+		err = app.migrate(ctx, *dryRun, app.Migrator.Pending, app.Migrator.Up, "Applied",
+			func(m data.Migration) string { return m.Up })
+	case "down":
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "migrate down: -steps must be at least 1")
+			return 2
+		}
+		err = app.migrate(ctx, *dryRun,
+			func(ctx context.Context) ([]data.Migration, error) { return app.Migrator.Reverting(ctx, *steps) },
+			func(ctx context.Context) ([]data.Migration, error) { return app.Migrator.Down(ctx, *steps) },
+			"Reverted",
+			func(m data.Migration) string { return m.Down })
+	case "status":
+		err = app.migrationStatus(ctx)
+	default:
+		fmt.Fprintf(os.Stderr, "migrate: unknown command %q, use up, down or status\n", command)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", command, err)
+		return 1
+	}
+
+	return 0
+}
+
+// migrate runs one direction of the migrations, or prints the SQL planned by plan when
+// dryRun is set.
+func (app *Config) migrate(
+	ctx context.Context,
+	dryRun bool,
+	plan, run func(context.Context) ([]data.Migration, error),
+	verb string,
+	sql func(data.Migration) string,
+) error {
+	if dryRun {
+		planned, err := plan(ctx)
+		if err != nil {
+			return err
+		}
+		if len(planned) == 0 {
+			fmt.Println("-- nothing to do")
+		}
+		for _, migration := range planned {
+			fmt.Printf("-- %s\n%s\n", migration, sql(migration))
+		}
+		return nil
+	}
+
+	done, err := run(ctx)
+	for _, migration := range done {
+		fmt.Printf("%s %s\n", verb, migration)
+	}
+	if err == nil && len(done) == 0 {
+		fmt.Println("Nothing to do")
+	}
+
+	return err
+}
+
+// migrationStatus prints every migration with whether it is applied.
+func (app *Config) migrationStatus(ctx context.Context) error {
+	applied, err := app.Migrator.Applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range app.Migrator.Migrations {
+		state := "pending"
+		if applied[migration.Version] {
+			state = "applied"
+		}
+		fmt.Printf("%-8s %s\n", state, migration)
+	}
+
+	return nil
+}
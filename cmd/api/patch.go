@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/patch"
+	"myRestAPIWithPagination/validation"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// acceptPatch lists the patch formats PATCH takes, for the Accept-Patch header.
+var acceptPatch = strings.Join([]string{patch.MergePatchType, patch.JSONPatchType}, ", ")
+
+// PatchEmployee changes some fields of an employee, and leaves the others as they are.
+// The body is a JSON Merge Patch, sent as application/merge-patch+json or plain
+// application/json, or a JSON Patch, sent as application/json-patch+json, whose test
+// operations can make the whole patch conditional:
+//
+//	[{"op": "test", "path": "/user_active", "value": true},
+//	 {"op": "replace", "path": "/user_active", "value": false}]
+//
+// Either applies to the fields a PUT has, email, first_name, last_name and user_active,
+// and the result must be as valid as the body of a PUT. None of them can be removed or
+// set to null. The patch is applied inside the
+// transaction reading the employee, so no update can get lost in between, and only the
+// fields that changed are written. With If-Match, only the version it names is patched.
+func (app *Config) PatchEmployee(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	check, err := app.ifMatch(r)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	apply, err := app.readPatch(w, r)
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	user, err := app.Models.User.Patch(id, func(user *data.User) error {
+		if check != nil {
+			if err := check(user); err != nil {
+				return err
+			}
+		}
+
+		doc, err := json.Marshal(NewEmployeeUpdate(user))
+		if err != nil {
+			return err
+		}
+
+		patched, err := apply(doc)
+		if err != nil {
+			return err
+		}
+
+		var employee EmployeeUpdate
+		if err := decodePatched(patched, &employee); err != nil {
+			return err
+		}
+
+		employee.Set(user)
+		return nil
+	})
+	if err != nil {
+		app.problem(w, r, err)
+		return
+	}
+
+	app.writeEmployee(w, http.StatusOK, user)
+}
+
+// decodePatched decodes a patched employee like decodeJSON does a body, and refuses the
+// fields the patch removed or set to null, instead of storing their zero value.
+func decodePatched(doc []byte, employee *EmployeeUpdate) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &members); err != nil {
+		return decodeJSON(bytes.NewReader(doc), employee)
+	}
+
+	var errs validation.Errors
+	removed := map[string]bool{}
+
+	fields := reflect.TypeOf(*employee)
+	for i := 0; i < fields.NumField(); i++ {
+		name := validation.FieldName(fields.Field(i))
+		if raw, ok := members[name]; !ok || string(raw) == "null" {
+			removed[name] = true
+			errs = append(errs, validation.FieldError{
+				Field:   name,
+				Code:    validation.CodeRequired,
+				Message: "can't be removed or set to null",
+			})
+		}
+	}
+
+	var decodeErrs validation.Errors
+	err := decodeJSON(bytes.NewReader(doc), employee)
+	if err != nil && !errors.As(err, &decodeErrs) {
+		return err
+	}
+
+	// a removed field is reported once, not again by its rules
+	for _, err := range decodeErrs {
+		if !removed[err.Field] {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// readPatch reads the patch in the body of the request, and returns the function
+// applying it to a JSON document. A malformed patch is refused before the employee is
+// even read.
+func (app *Config) readPatch(w http.ResponseWriter, r *http.Request) (func(doc []byte) ([]byte, error), error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case patch.MergePatchType, patch.JSONPatchType, "application/json":
+	default:
+		w.Header().Set("Accept-Patch", acceptPatch)
+		return nil, &apiError{
+			status: http.StatusUnsupportedMediaType,
+			code:   codeUnsupportedMediaType,
+			detail: fmt.Sprintf("send a patch as %s", acceptPatch),
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBytes))
+	if err != nil {
+		return nil, errBadRequest(codeBadRequest, err.Error())
+	}
+
+	if mediaType == patch.JSONPatchType {
+		operations, err := patch.Parse(body)
+		if err != nil {
+			return nil, err
+		}
+		return operations.Apply, nil
+	}
+
+	// a merge patch of anything but an object would replace the whole employee
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return nil, fmt.Errorf("%w: a merge patch must be a JSON object", patch.ErrMalformed)
+	}
+
+	return func(doc []byte) ([]byte, error) {
+		return patch.Merge(doc, body)
+	}, nil
+}
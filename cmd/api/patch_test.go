@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPatchEmployee(t *testing.T) {
+	app := newTestApp(t)
+	alice := addUser(t, app, "alice@example.com", time.Now())
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		want        func(EmployeeView) bool
+	}{
+		{
+			name:        "merge patch",
+			contentType: "application/merge-patch+json",
+			body:        `{"last_name":"Smith"}`,
+			status:      http.StatusOK,
+			want:        func(e EmployeeView) bool { return e.LastName == "Smith" && e.FirstName == "alice" && e.Active },
+		},
+		{
+			name:        "plain JSON is a merge patch",
+			contentType: "application/json",
+			body:        `{"first_name":"Alice"}`,
+			status:      http.StatusOK,
+			want:        func(e EmployeeView) bool { return e.FirstName == "Alice" && e.LastName == "Smith" },
+		},
+		{
+			name:        "JSON Patch with a test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"test","path":"/user_active","value":true},{"op":"replace","path":"/user_active","value":false}]`,
+			status:      http.StatusOK,
+			want:        func(e EmployeeView) bool { return !e.Active && e.LastName == "Smith" },
+		},
+		{
+			name:        "failing test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"test","path":"/user_active","value":true},{"op":"replace","path":"/last_name","value":"Jones"}]`,
+			status:      http.StatusConflict,
+			code:        codePatchTestFailed,
+		},
+		{
+			name:        "missing path",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/nickname","value":"Al"}]`,
+			status:      http.StatusUnprocessableEntity,
+			code:        codePatchPath,
+		},
+		{
+			name:        "null",
+			contentType: "application/merge-patch+json",
+			body:        `{"user_active":null}`,
+			status:      http.StatusUnprocessableEntity,
+			code:        codeValidationFailed,
+		},
+		{
+			name:        "replace with null",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/user_active","value":null}]`,
+			status:      http.StatusUnprocessableEntity,
+			code:        codeValidationFailed,
+		},
+		{
+			name:        "remove",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"remove","path":"/last_name"}]`,
+			status:      http.StatusUnprocessableEntity,
+			code:        codeValidationFailed,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"add","path":"/password","value":"secret123"}]`,
+			status:      http.StatusUnprocessableEntity,
+			code:        codeValidationFailed,
+		},
+		{
+			name:        "invalid email",
+			contentType: "application/merge-patch+json",
+			body:        `{"email":"alice"}`,
+			status:      http.StatusUnprocessableEntity,
+			code:        codeValidationFailed,
+		},
+		{
+			name:        "merge patch of an array",
+			contentType: "application/merge-patch+json",
+			body:        `[]`,
+			status:      http.StatusBadRequest,
+			code:        codeInvalidPatch,
+		},
+		{
+			name:        "malformed JSON Patch",
+			contentType: "application/json-patch+json",
+			body:        `{"op":"remove","path":"/last_name"}`,
+			status:      http.StatusBadRequest,
+			code:        codeInvalidPatch,
+		},
+		{
+			name:        "unsupported media type",
+			contentType: "text/plain",
+			body:        `{"last_name":"Jones"}`,
+			status:      http.StatusUnsupportedMediaType,
+			code:        codeUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := app.Models.User.GetOne(alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := request(app, http.MethodPatch, employeeURL(alice.ID), defaultAdminEmail, tt.contentType, tt.body, nil)
+
+			if tt.want != nil {
+				if got := decode[EmployeeView](t, w, tt.status); !tt.want(got) {
+					t.Errorf("patched into %+v", got)
+				}
+				return
+			}
+
+			if problem := decode[testProblem](t, w, tt.status); problem.Code != tt.code {
+				t.Errorf("code %q, want %q", problem.Code, tt.code)
+			}
+
+			// a refused patch changes nothing
+			after, err := app.Models.User.GetOne(alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Version != before.Version || after.Active != before.Active || after.LastName != before.LastName {
+				t.Errorf("a refused patch changed %+v into %+v", before, after)
+			}
+		})
+	}
+
+	w := request(app, http.MethodPatch, employeeURL(alice.ID), defaultAdminEmail, "text/plain", "", nil)
+	if accept := w.Header().Get("Accept-Patch"); accept != acceptPatch {
+		t.Errorf("Accept-Patch = %q, want %q", accept, acceptPatch)
+	}
+}
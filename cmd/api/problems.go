@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
+	"myRestAPIWithPagination/patch"
+	"myRestAPIWithPagination/validation"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+// The codes of the problems the API responds with. They are stable: clients may switch
+// on them, while titles and details are for people.
+const (
+	codeBadRequest           = "bad_request"
+	codeInvalidJSON          = "invalid_json"
+	codeInvalidParameter     = "invalid_parameter"
+	codeInvalidCursor        = "invalid_cursor"
+	codeValidationFailed     = "validation_failed"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeInvalidPatch         = "invalid_patch"
+	codePatchTestFailed      = "patch_test_failed"
+	codePatchPath            = "patch_path_not_found"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeInternal             = "internal"
+)
+
+// problemContentType is the media type of RFC 7807 error responses.
+const problemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of every error response. Type is a relative URI made of
+// the code, which is repeated as an extension member, along with the id of the request
+// to quote when reporting it, and the field errors of invalid payloads.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    validation.Errors `json:"errors,omitempty"`
+}
+
+// apiError is an error the handlers know how to respond to. err is the underlying
+// cause, which is logged but not sent to the client.
+type apiError struct {
+	status int
+	code   string
+	detail string
+	errs   validation.Errors
+	err    error
+}
+
+func (e *apiError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.code, e.detail, e.err)
+	}
+
+	return e.code + ": " + e.detail
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+func errBadRequest(code, detail string) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: code, detail: detail}
+}
+
+// errInvalidParameter reports a query or path parameter the handler can't use.
+func errInvalidParameter(err error) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: codeInvalidParameter, detail: err.Error()}
+}
+
+// errInvalidCursor reports a cursor that doesn't decode, verify or fit the query. Which
+// one it is is logged only, to not help forging cursors.
+func errInvalidCursor(err error) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: codeInvalidCursor, detail: "the cursor is invalid or has expired", err: err}
+}
+
+func errUnauthorized(detail string) *apiError {
+	return &apiError{status: http.StatusUnauthorized, code: codeUnauthorized, detail: detail}
+}
+
+func errForbidden(detail string) *apiError {
+	return &apiError{status: http.StatusForbidden, code: codeForbidden, detail: detail}
+}
+
+func errNotFound(detail string) *apiError {
+	return &apiError{status: http.StatusNotFound, code: codeNotFound, detail: detail}
+}
+
+// errPreconditionFailed reports an If-Match naming another version than the stored one:
+// the employee changed since the client read it.
+func errPreconditionFailed() *apiError {
+	return &apiError{
+		status: http.StatusPreconditionFailed,
+		code:   codePreconditionFailed,
+		detail: "the employee changed since it was read, fetch it again and retry",
+	}
+}
+
+// errPreconditionRequired reports a change without If-Match when it is required.
+func errPreconditionRequired() *apiError {
+	return &apiError{
+		status: http.StatusPreconditionRequired,
+		code:   codePreconditionRequired,
+		detail: "send the ETag of the employee in If-Match",
+	}
+}
+
+// errInternal reports a failure of the server. detail says what couldn't be done, err is
+// why, and is only logged.
+func errInternal(detail string, err error) *apiError {
+	return &apiError{status: http.StatusInternalServerError, code: codeInternal, detail: detail, err: err}
+}
+
+// toAPIError maps any error to the problem it is: the errors of the other packages to
+// their meaning, and everything unknown to an internal error.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	var errs validation.Errors
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &errs):
+		return &apiError{
+			status: http.StatusUnprocessableEntity,
+			code:   codeValidationFailed,
+			detail: "the request has invalid fields",
+			errs:   errs,
+		}
+	case errors.Is(err, data.ErrNotFound):
+		return &apiError{status: http.StatusNotFound, code: codeNotFound, detail: "the employee doesn't exist"}
+	case errors.Is(err, data.ErrDuplicate):
+		return &apiError{status: http.StatusConflict, code: codeConflict, detail: "the email is already taken", err: err}
+	case errors.Is(err, patch.ErrMalformed):
+		return &apiError{status: http.StatusBadRequest, code: codeInvalidPatch, detail: err.Error()}
+	case errors.Is(err, patch.ErrTestFailed):
+		// RFC 5789 calls a resource not in the state the patch expects a conflict
+		return &apiError{status: http.StatusConflict, code: codePatchTestFailed, detail: err.Error()}
+	case errors.Is(err, patch.ErrPath):
+		return &apiError{status: http.StatusUnprocessableEntity, code: codePatchPath, detail: err.Error()}
+	case errors.Is(err, pagination.ErrCursorMalformed),
+		errors.Is(err, pagination.ErrCursorSignature),
+		errors.Is(err, pagination.ErrCursorVersion),
+		errors.Is(err, pagination.ErrCursorExpired),
+		errors.Is(err, pagination.ErrCursorMismatch):
+		return errInvalidCursor(err)
+	default:
+		return errInternal("the request couldn't be completed", err)
+	}
+}
+
+// problem responds to a request with the problem err maps to. Handlers return right
+// after calling it.
+func (app *Config) problem(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	requestID := middleware.GetReqID(r.Context())
+
+	event := log.Info()
+	if apiErr.status >= http.StatusInternalServerError {
+		event = log.Error()
+	}
+	event.Str("request_id", requestID).Str("code", apiErr.code).Err(err).Msgf("%s %s failed", r.Method, r.URL.Path)
+
+	problem := Problem{
+		Type:      "/problems/" + apiErr.code,
+		Title:     http.StatusText(apiErr.status),
+		Status:    apiErr.status,
+		Detail:    apiErr.detail,
+		Instance:  r.URL.Path,
+		Code:      apiErr.code,
+		RequestID: requestID,
+		Errors:    apiErr.errs,
+	}
+
+	headers := http.Header{"Content-Type": []string{problemContentType}}
+	if apiErr.status == http.StatusUnauthorized {
+		headers.Set("WWW-Authenticate", `Basic realm="employees"`)
+	}
+
+	app.writeJSON(w, apiErr.status, problem, headers)
+}
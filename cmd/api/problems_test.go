@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"myRestAPIWithPagination/data"
+	"myRestAPIWithPagination/pagination"
+	"myRestAPIWithPagination/patch"
+	"myRestAPIWithPagination/validation"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{errNotFound("no such page"), http.StatusNotFound, codeNotFound},
+		{fmt.Errorf("reading: %w", errInvalidParameter(errors.New("bad"))), http.StatusBadRequest, codeInvalidParameter},
+		{validation.Errors{{Field: "email", Code: validation.CodeEmail}}, http.StatusUnprocessableEntity, codeValidationFailed},
+		{data.ErrNotFound, http.StatusNotFound, codeNotFound},
+		{fmt.Errorf("%w: unique violation", data.ErrDuplicate), http.StatusConflict, codeConflict},
+		{fmt.Errorf("%w: not a list", patch.ErrMalformed), http.StatusBadRequest, codeInvalidPatch},
+		{patch.ErrTestFailed, http.StatusConflict, codePatchTestFailed},
+		{patch.ErrPath, http.StatusUnprocessableEntity, codePatchPath},
+		{pagination.ErrCursorExpired, http.StatusBadRequest, codeInvalidCursor},
+		{pagination.ErrCursorMismatch, http.StatusBadRequest, codeInvalidCursor},
+		{errors.New("connection refused"), http.StatusInternalServerError, codeInternal},
+	}
+
+	for _, tt := range tests {
+		apiErr := toAPIError(tt.err)
+		if apiErr.status != tt.status || apiErr.code != tt.code {
+			t.Errorf("toAPIError(%v) = %d %s, want %d %s", tt.err, apiErr.status, apiErr.code, tt.status, tt.code)
+		}
+	}
+
+	// the causes of internal errors are logged, never sent
+	if apiErr := toAPIError(errors.New("password authentication failed for user postgres")); strings.Contains(apiErr.detail, "postgres") {
+		t.Errorf("an internal error is detailed as %q", apiErr.detail)
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	app := newTestApp(t)
+	missing := data.NewUUID()
+
+	w := request(app, http.MethodGet, employeeURL(missing), defaultAdminEmail, "", "", nil)
+	problem := decode[Problem](t, w, http.StatusNotFound)
+
+	if contentType := w.Header().Get("Content-Type"); contentType != problemContentType {
+		t.Errorf("Content-Type = %q, want %q", contentType, problemContentType)
+	}
+	want := Problem{
+		Type:      "/problems/not_found",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    problem.Detail,
+		Instance:  employeeURL(missing),
+		Code:      codeNotFound,
+		RequestID: w.Header().Get(middleware.RequestIDHeader),
+	}
+	if problem.RequestID == "" || problem.Detail == "" || !reflect.DeepEqual(problem, want) {
+		t.Errorf("the problem is %+v, want %+v", problem, want)
+	}
+
+	w = request(app, http.MethodGet, employeesPath, "nobody@example.com", "", "", nil)
+	if problem := decode[Problem](t, w, http.StatusUnauthorized); problem.Code != codeUnauthorized {
+		t.Errorf("an unknown user: code %q, want %q", problem.Code, codeUnauthorized)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Basic ") {
+		t.Errorf("WWW-Authenticate = %q, want a Basic challenge", challenge)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// purgeDeleted removes the employees deleted longer than DeletedRetention ago, now and
+// then every PurgeInterval, for as long as the API runs. Replicas purging at the same
+// time just find nothing left to remove.
+func (app *Config) purgeDeleted() {
+	ticker := time.NewTicker(app.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.Models.User.Purge(time.Now().Add(-app.DeletedRetention))
+		if err != nil {
+			log.Error().Err(err).Msg("Can't purge deleted employees")
+		} else if purged > 0 {
+			log.Info().Msgf("Purged %d employees deleted more than %s ago", purged, app.DeletedRetention)
+		}
+
+		<-ticker.C
+	}
+}
+
+// purgeCommand runs "purge [-older-than]" and returns the exit code, for purging by hand
+// or from a scheduler instead of from the API. -older-than defaults to DELETED_RETENTION,
+// and must be given when that is 0.
+func (app *Config) purgeCommand(args []string) int {
+	flags := commandFlags("purge")
+	olderThan := flags.Duration("older-than", app.DeletedRetention, "purge employees deleted longer ago than this, 0 for all of them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *olderThan < 0 {
+		return fail("purge", fmt.Errorf("-older-than can't be negative"))
+	}
+
+	// DELETED_RETENTION=0 keeps deleted employees forever, so its 0 isn't a default to
+	// purge all of them with
+	given := false
+	flags.Visit(func(f *flag.Flag) { given = given || f.Name == "older-than" })
+	if app.DeletedRetention == 0 && !given {
+		return fail("purge", fmt.Errorf("DELETED_RETENTION=0 keeps deleted employees, give -older-than to purge anyway"))
+	}
+
+	purged, err := app.Models.User.Purge(time.Now().Add(-*olderThan))
+	if err != nil {
+		return fail("purge", err)
+	}
+
+	fmt.Printf("Purged %d employees\n", purged)
+
+	return 0
+}
@@ -8,29 +8,57 @@ import (
 	"github.com/go-chi/cors"
 )
 
+// employeesPath is the collection of employees, under the version prefix of the API.
+const employeesPath = "/v1/employees"
+
+// employeeURL returns the URL of one employee.
+func employeeURL(id string) string {
+	return employeesPath + "/" + id
+}
+
 func (app *Config) route() http.Handler {
 	mux := chi.NewRouter()
 
 	// specify who is allowed to connect
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", middleware.RequestIDHeader},
+		ExposedHeaders:   []string{"ETag", "Link", "Location", "Content-Disposition", "Deprecation", "Sunset", "Accept-Patch", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
+	mux.Use(middleware.RequestID)
+	mux.Use(app.EchoRequestID)
 	mux.Use(middleware.Logger)
 	mux.Use(app.Authenticate)
 
-	mux.Post("/create-employee", app.CreateEmployee)
-	mux.Get("/get-employee/{id}", app.GetEmployeeByID)
-	mux.Put("/update-employee/{id}", app.UpdateEmployee)
-	mux.Delete("/delete-employee/{id}", app.DeleteEmployee)
+	mux.Route(employeesPath, func(mux chi.Router) {
+		mux.Get("/", app.ListEmployees)
+		mux.Post("/", app.CreateEmployee)
+		mux.Get("/changes", app.GetEmployeeChanges)
+		mux.Post("/import", app.ImportEmployees)
+		mux.Get("/export", app.ExportEmployees)
+		mux.Get("/{id}", app.GetEmployeeByID)
+		mux.Put("/{id}", app.UpdateEmployee)
+		mux.Patch("/{id}", app.PatchEmployee)
+		mux.Delete("/{id}", app.DeleteEmployee)
+		mux.Post("/{id}/restore", app.RestoreEmployee)
+	})
+
+	// the routes from before /v1, kept until the sunset for the clients still using them
+	mux.With(app.Deprecated(employeesPath)).Post("/create-employee", app.CreateEmployee)
+	mux.With(app.Deprecated(employeesPath+"/{id}")).Get("/get-employee/{id}", app.GetEmployeeByID)
+	mux.With(app.Deprecated(employeesPath+"/{id}")).Put("/update-employee/{id}", app.UpdateEmployee)
+	mux.With(app.Deprecated(employeesPath+"/{id}")).Delete("/delete-employee/{id}", app.DeleteEmployee)
 	// mux.Get("/get-all-employee?{limit}=limitNumber&{cursor}=base64_string_from_previous_result", app.GetAllEmployee)
-	mux.Get("/get-all-employee/{limit}/{cursor}", app.GetAllEmployee)
+	mux.With(app.Deprecated(employeesPath)).Get("/get-all-employee/{limit}/{cursor}", app.GetAllEmployee)
+	mux.With(app.Deprecated(employeesPath)).Get("/get-all-employee", app.GetEmployeePage)
+	mux.With(app.Deprecated(employeesPath+"/changes")).Get("/employees/changes", app.GetEmployeeChanges)
+	mux.With(app.Deprecated(employeesPath+"/import")).Post("/employees/import", app.ImportEmployees)
+	mux.With(app.Deprecated(employeesPath+"/export")).Get("/employees/export", app.ExportEmployees)
 
 	return mux
 }
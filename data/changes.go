@@ -0,0 +1,37 @@
+package data
+
+import (
+	"myRestAPIWithPagination/pagination"
+	"time"
+)
+
+// The types of change reported by the change feed.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change is one entry of the users change feed: the latest state of a user created or
+// updated after the feed position, or the tombstone of a deleted one.
+type Change struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	ChangedAt time.Time `json:"changed_at"`
+	User      *User     `json:"employee,omitempty"`
+}
+
+// ChangeKeyset orders the change feed by (changed_at, id), where changed_at is the
+// updated_at of a user or the deleted_at of a tombstone.
+var ChangeKeyset = pagination.Keyset[*Change]{
+	Columns:    map[string]pagination.Kind{"changed_at": pagination.Time},
+	Tiebreaker: "id",
+	Default:    pagination.Sort{{Column: "changed_at"}},
+	Value: func(c *Change, column string) any {
+		if column == "changed_at" {
+			return c.ChangedAt
+		}
+		return c.ID
+	},
+	TimeLayout: cursorTimeLayout,
+}
@@ -0,0 +1,517 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"myRestAPIWithPagination/pagination"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository is a UserRepository keeping users in memory, for running the API
+// without postgres during development and for handler tests. It behaves like the
+// postgres storage: emails are unique, missing users are reported with ErrNotFound,
+// and listings are ordered and filtered the same way, except that text is compared byte
+// by byte instead of with the database collation.
+type MemoryUserRepository struct {
+	mu         sync.RWMutex
+	users      map[string]User
+	tombstones map[string]time.Time
+}
+
+var _ UserRepository = (*MemoryUserRepository)(nil)
+
+// NewMemoryUserRepository returns an empty in-memory UserRepository.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:      map[string]User{},
+		tombstones: map[string]time.Time{},
+	}
+}
+
+// now returns the current time at the microsecond precision of the postgres timestamp
+// columns, so cursors built from it round-trip the same way.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// NewUUID returns a random version 4 UUID, like uuid_generate_v4() in postgres. Users
+// can be given their id before they are inserted with it.
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// emailTaken reports whether another user than id already has the email. The caller
+// must hold the lock.
+func (m *MemoryUserRepository) emailTaken(email, id string) bool {
+	for _, user := range m.users {
+		if user.ID != id && user.Email == email {
+			return true
+		}
+	}
+
+	return false
+}
+
+// live returns the user with the given id, unless there is none or it is deleted. The
+// caller must hold the lock.
+func (m *MemoryUserRepository) live(id string) (User, bool) {
+	user, ok := m.users[id]
+	if !ok || user.DeletedAt != nil {
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// list returns copies of the users matching the filter, in the order of the sort. The
+// caller must hold the lock.
+func (m *MemoryUserRepository) list(filter Filter, sort pagination.Sort) []*User {
+	var users []*User
+	for _, user := range m.users {
+		if filter.matches(&user) {
+			user := user
+			users = append(users, &user)
+		}
+	}
+
+	slices.SortFunc(users, func(a, b *User) int {
+		return UserKeyset.Compare(sort, a, b)
+	})
+
+	return users
+}
+
+// hidePasswords sets the password of the listed users to "-", like the postgres
+// listings do.
+func hidePasswords(users []*User) []*User {
+	for _, user := range users {
+		user.Password = "-"
+	}
+
+	return users
+}
+
+// GetAll returns a slice of all users, sorted by last name
+func (m *MemoryUserRepository) GetAll() ([]*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.list(Filter{}, pagination.Sort{{Column: "last_name"}}), nil
+}
+
+// GetByEmail returns one user by email
+func (m *MemoryUserRepository) GetByEmail(email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email && user.DeletedAt == nil {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// CheckId returns ErrNotFound if there is no user with the given id
+func (m *MemoryUserRepository) CheckId(id string) error {
+	_, err := m.GetOne(id)
+	return err
+}
+
+// GetOne returns one user by id
+func (m *MemoryUserRepository) GetOne(id string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+// Insert stores a new user with a hashed password, and returns its id
+func (m *MemoryUserRepository) Insert(user User) (string, error) {
+	// hash before taking the lock, bcrypt is slow on purpose
+	hashedPassword, err := HashPassword(user.Password)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(user.Email, "") {
+		return "", ErrDuplicate
+	}
+
+	user.ID = NewUUID()
+	user.Password = string(hashedPassword)
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	m.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// BulkInsert stores the users as they are, all of them or none
+func (m *MemoryUserRepository) BulkInsert(users []User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// check the whole batch before storing any of it
+	ids := map[string]bool{}
+	emails := map[string]bool{}
+	batch := slices.Clone(users)
+	for i := range batch {
+		if batch[i].ID == "" {
+			batch[i].ID = NewUUID()
+		}
+		batch[i].Version = 1
+
+		_, taken := m.users[batch[i].ID]
+		if taken || ids[batch[i].ID] || emails[batch[i].Email] || m.emailTaken(batch[i].Email, "") {
+			return ErrDuplicate
+		}
+		ids[batch[i].ID] = true
+		emails[batch[i].Email] = true
+	}
+
+	for _, user := range batch {
+		m.users[user.ID] = user
+	}
+
+	return nil
+}
+
+// Import stores the users as they are, except for the ones whose email is taken, created
+// now
+func (m *MemoryUserRepository) Import(users []User, allOrNothing bool) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	duplicates := make([]bool, len(users))
+	emails := map[string]bool{}
+	skipped := false
+	for i, user := range users {
+		if emails[user.Email] || m.emailTaken(user.Email, "") {
+			duplicates[i] = true
+			skipped = true
+		}
+		emails[user.Email] = true
+	}
+
+	if skipped && allOrNothing {
+		return duplicates, nil
+	}
+
+	importedAt := now()
+	for i, user := range users {
+		if duplicates[i] {
+			continue
+		}
+		if user.ID == "" {
+			user.ID = NewUUID()
+		}
+		user.CreatedAt = importedAt
+		user.UpdatedAt = importedAt
+		user.Version = 1
+		m.users[user.ID] = user
+	}
+
+	return duplicates, nil
+}
+
+// Update updates the email, names and active flag of the user with user.ID
+func (m *MemoryUserRepository) Update(user User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.live(user.ID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	if m.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+
+	stored.Email = user.Email
+	stored.FirstName = user.FirstName
+	stored.LastName = user.LastName
+	stored.Active = user.Active
+	stored.UpdatedAt = now()
+	stored.Version++
+	m.users[user.ID] = stored
+
+	return nil
+}
+
+// Patch lets apply change a copy of the user with the given id, and stores it if it did
+func (m *MemoryUserRepository) Patch(id string, apply func(*User) error) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	patched := stored
+	if err := apply(&patched); err != nil {
+		return nil, err
+	}
+	if patched.Email == stored.Email && patched.FirstName == stored.FirstName &&
+		patched.LastName == stored.LastName && patched.Active == stored.Active {
+		return &stored, nil
+	}
+
+	if m.emailTaken(patched.Email, id) {
+		return nil, ErrDuplicate
+	}
+
+	stored.Email = patched.Email
+	stored.FirstName = patched.FirstName
+	stored.LastName = patched.LastName
+	stored.Active = patched.Active
+	stored.UpdatedAt = now()
+	stored.Version++
+	m.users[id] = stored
+
+	return &stored, nil
+}
+
+// Delete marks one user as deleted by id if check passes, leaving a tombstone for the
+// change feed, or returns ErrNotFound
+func (m *MemoryUserRepository) Delete(id string, check func(*User) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.live(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if check != nil {
+		if err := check(&user); err != nil {
+			return err
+		}
+	}
+
+	deletedAt := now()
+	user.DeletedAt = &deletedAt
+	m.users[id] = user
+	m.tombstones[id] = deletedAt
+
+	return nil
+}
+
+// Restore undeletes the user with the given id, or returns ErrNotFound
+func (m *MemoryUserRepository) Restore(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.DeletedAt == nil {
+		return nil
+	}
+
+	user.DeletedAt = nil
+	user.UpdatedAt = now()
+	user.Version++
+	m.users[id] = user
+	delete(m.tombstones, id)
+
+	return nil
+}
+
+// Purge removes the users deleted before the given time and their tombstones, and
+// returns how many users
+func (m *MemoryUserRepository) Purge(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, user := range m.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(before) {
+			delete(m.users, id)
+			purged++
+		}
+	}
+	for id, deletedAt := range m.tombstones {
+		if deletedAt.Before(before) {
+			delete(m.tombstones, id)
+		}
+	}
+
+	return purged, nil
+}
+
+// ResetPassword hashes and stores a new password for the user with the given id, or
+// returns ErrNotFound
+func (m *MemoryUserRepository) ResetPassword(id, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.live(id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	user.Password = string(hashedPassword)
+	m.users[id] = user
+
+	return nil
+}
+
+// GetAllForPagination returns a keyset page of users, exactly like
+// PostgresUserRepository.GetAllForPagination.
+func (m *MemoryUserRepository) GetAllForPagination(filter Filter, sort pagination.Sort, cursor *pagination.Cursor, limit int) ([]*User, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := m.list(filter, sort)
+
+	backward := cursor != nil && cursor.Backward
+
+	if cursor != nil {
+		users = slices.DeleteFunc(users, func(u *User) bool {
+			return !UserKeyset.After(sort, u, cursor)
+		})
+	}
+
+	// walk the rows the other way round, like the reversed order by does in postgres
+	if backward {
+		slices.Reverse(users)
+	}
+
+	users = users[:min(len(users), limit+1)]
+
+	users, hasMore := pagination.Trim(users, limit, backward)
+
+	return hidePasswords(users), hasMore, nil
+}
+
+// GetPage returns an offset page of users
+func (m *MemoryUserRepository) GetPage(filter Filter, sort pagination.Sort, offset, limit int) ([]*User, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("negative offset %d", offset)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := m.list(filter, sort)
+	users = users[min(len(users), offset):]
+	users = users[:min(len(users), limit)]
+
+	return hidePasswords(users), nil
+}
+
+// Export calls each with the users matching the filter. The lock is only held to list
+// them, not while each runs.
+func (m *MemoryUserRepository) Export(ctx context.Context, filter Filter, sort pagination.Sort, each func(*User) error) error {
+	m.mu.RLock()
+	users := m.list(filter, sort)
+	m.mu.RUnlock()
+
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		user.Password = ""
+		if err := each(user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of users matching the filter
+func (m *MemoryUserRepository) Count(filter Filter) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, user := range m.users {
+		if filter.matches(&user) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// EstimateCount returns the exact count, which is as cheap as it gets in memory
+func (m *MemoryUserRepository) EstimateCount(filter Filter) (int64, error) {
+	return m.Count(filter)
+}
+
+// GetChanges returns the next batch of the change feed after since and before until,
+// exactly like PostgresUserRepository.GetChanges.
+func (m *MemoryUserRepository) GetChanges(since *pagination.Cursor, until time.Time, limit int) ([]*Change, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sort := ChangeKeyset.Default
+
+	var changes []*Change
+
+	for _, user := range m.users {
+		if user.DeletedAt != nil {
+			continue
+		}
+
+		user := user
+		user.Password = "-"
+		change := &Change{Type: ChangeUpdated, ID: user.ID, ChangedAt: user.UpdatedAt, User: &user}
+
+		// a user is new to the client when it was created after the position it synced to
+		created := &Change{ID: user.ID, ChangedAt: user.CreatedAt}
+		if since == nil || ChangeKeyset.After(sort, created, since) {
+			change.Type = ChangeCreated
+		}
+
+		changes = append(changes, change)
+	}
+
+	for id, deletedAt := range m.tombstones {
+		changes = append(changes, &Change{Type: ChangeDeleted, ID: id, ChangedAt: deletedAt})
+	}
+
+	changes = slices.DeleteFunc(changes, func(c *Change) bool {
+		return !c.ChangedAt.Before(until) || (since != nil && !ChangeKeyset.After(sort, c, since))
+	})
+
+	slices.SortFunc(changes, func(a, b *Change) int {
+		return ChangeKeyset.Compare(sort, a, b)
+	})
+
+	changes = changes[:min(len(changes), limit+1)]
+
+	changes, hasMore := pagination.Trim(changes, limit, false)
+
+	return changes, hasMore, nil
+}
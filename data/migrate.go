@@ -0,0 +1,328 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema of every SQL storage as numbered migrations, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockKey is the postgres advisory lock held while migrating, so replicas
+// starting together don't apply the same migration twice.
+const migrationLockKey = 7_203_114_001
+
+// Migration is one numbered schema change, with the SQL applying and reverting it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String returns the file name of the migration without the direction.
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Migrator applies the migrations of one database, recording the applied versions in
+// the schema_migrations table.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+	// lock serializes migrators of the same database, and returns the function releasing
+	// the lock
+	lock func(ctx context.Context, conn *sql.Conn) (func(), error)
+	// tableExists reports whether schema_migrations has been created
+	tableExists string
+}
+
+// NewPostgresMigrator returns the Migrator of a postgres database, locking it with a
+// session advisory lock while migrating.
+func NewPostgresMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations("migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:          db,
+		Migrations:  migrations,
+		lock:        postgresAdvisoryLock,
+		tableExists: `select to_regclass('schema_migrations') is not null`,
+	}, nil
+}
+
+// NewSQLiteMigrator returns the Migrator of a sqlite database. sqlite already allows a
+// single writer at a time, and each migration is applied in a transaction together with
+// its schema_migrations row, so a racing migrator fails instead of applying it twice.
+func NewSQLiteMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations("migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+		lock: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+			return func() {}, nil
+		},
+		tableExists: `select count(*) > 0 from sqlite_master where type = 'table' and name = 'schema_migrations'`,
+	}, nil
+}
+
+func postgresAdvisoryLock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	if _, err := conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// the lock goes away with the session anyway, so an error here is harmless
+		conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, migrationLockKey)
+	}, nil
+}
+
+// loadMigrations reads the migrations in dir of migrationFiles, sorted by version. Every
+// migration must have both an up and a down file.
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || !strings.HasSuffix(name, ".sql") || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>.up.sql or .down.sql", name)
+		}
+
+		number, title, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", name, number)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		if migration.Name != title {
+			return nil, fmt.Errorf("migration %s: version %d is also named %s", name, version, migration.Name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s: both the up and the down file are required", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Applied returns the versions recorded in schema_migrations, without creating the table
+// when it doesn't exist yet.
+func (m *Migrator) Applied(ctx context.Context) (map[int]bool, error) {
+	return m.applied(ctx, m.DB)
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m *Migrator) applied(ctx context.Context, db queryer) (map[int]bool, error) {
+	applied := map[int]bool{}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, m.tableExists).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `select version from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// Pending returns the migrations Up would apply, in order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.pending(applied), nil
+}
+
+func (m *Migrator) pending(applied map[int]bool) []Migration {
+	var pending []Migration
+	for _, migration := range m.Migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending
+}
+
+// Reverting returns the migrations Down(steps) would revert, latest first.
+func (m *Migrator) Reverting(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.reverting(applied, steps), nil
+}
+
+func (m *Migrator) reverting(applied map[int]bool, steps int) []Migration {
+	var reverting []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(reverting) < steps; i-- {
+		if applied[m.Migrations[i].Version] {
+			reverting = append(reverting, m.Migrations[i])
+		}
+	}
+
+	return reverting
+}
+
+// Up applies every pending migration, each in its own transaction, and returns the
+// applied ones. On error the migrations applied before the failing one stay applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]bool) error {
+		for _, migration := range m.pending(applied) {
+			err := m.apply(ctx, conn, migration.Up,
+				`insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)`,
+				migration.Version, migration.Name, formatTime(time.Now()))
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, latest first, and returns the
+// reverted ones.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int]bool) error {
+		for _, migration := range m.reverting(applied, steps) {
+			err := m.apply(ctx, conn, migration.Down,
+				`delete from schema_migrations where version = $1`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// locked runs migrate on a connection holding the migration lock, with the versions
+// applied by then.
+func (m *Migrator) locked(ctx context.Context, migrate func(conn *sql.Conn, applied map[int]bool) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("can't lock the migrations: %w", err)
+	}
+	defer unlock()
+
+	stmt := `create table if not exists schema_migrations (
+		version bigint primary key not null,
+		name varchar(255) not null,
+		applied_at timestamp not null
+	)`
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return migrate(conn, applied)
+}
+
+// apply runs the SQL of a migration and records it in schema_migrations, in one
+// transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func versions(migrations []Migration) []int {
+	var versions []int
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+
+	return versions
+}
+
+func TestLoadMigrations(t *testing.T) {
+	var names [2][]string
+
+	for i, dir := range []string{"migrations/postgres", "migrations/sqlite"} {
+		migrations, err := loadMigrations(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j, migration := range migrations {
+			if migration.Version != j+1 {
+				t.Errorf("%s: migration %s is number %d", dir, migration, j+1)
+			}
+			if migration.Up == "" || migration.Down == "" {
+				t.Errorf("%s: migration %s doesn't go both ways", dir, migration)
+			}
+			names[i] = append(names[i], migration.String())
+		}
+	}
+
+	if !slices.Equal(names[0], names[1]) {
+		t.Errorf("postgres has the migrations %v, sqlite %v", names[0], names[1])
+	}
+}
+
+func TestSQLiteMigrator(t *testing.T) {
+	ctx := context.Background()
+	db, migrator := openTestSQLite(t)
+	all := versions(migrator.Migrations)
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || !slices.Equal(versions(pending), all) {
+		t.Fatalf("Pending() of an empty database = %v, %v, want %v", versions(pending), err, all)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil || !slices.Equal(versions(applied), all) {
+		t.Fatalf("Up() = %v, %v, want %v", versions(applied), err, all)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("Up() again = %v, %v, want nothing", versions(applied), err)
+	}
+
+	latest := all[len(all)-1]
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil || !slices.Equal(versions(reverted), []int{latest}) {
+		t.Errorf("Down(1) = %v, %v, want [%d]", versions(reverted), err, latest)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || !slices.Equal(versions(pending), []int{latest}) {
+		t.Errorf("Pending() after Down(1) = %v, %v, want [%d]", versions(pending), err, latest)
+	}
+
+	// every down migration has to undo its up migration for the whole way to work
+	want := slices.Clone(all[:len(all)-1])
+	slices.Reverse(want)
+	if reverted, err := migrator.Down(ctx, len(all)); err != nil || !slices.Equal(versions(reverted), want) {
+		t.Fatalf("Down(all) = %v, %v, want %v", versions(reverted), err, want)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || !slices.Equal(versions(applied), all) {
+		t.Fatalf("Up() after Down(all) = %v, %v, want %v", versions(applied), err, all)
+	}
+
+	repository := NewSQLiteUserRepository(db)
+	if err := repository.BulkInsert(testUsers(2)); err != nil {
+		t.Errorf("the migrated schema can't store users: %v", err)
+	}
+}
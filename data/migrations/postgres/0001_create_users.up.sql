@@ -0,0 +1,15 @@
+-- users are keyed by a uuid, and paged through (created_at, id), see
+-- idx_users_pagination. "if not exists" lets databases created from
+-- DatabaseQuery.SQL before migrations existed adopt them.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+CREATE TABLE IF NOT EXISTS "users" (
+    id VARCHAR(255) PRIMARY KEY NOT NULL DEFAULT (uuid_generate_v4()),
+    email varchar(50) unique not null,
+    first_name varchar(50) not null,
+    last_name varchar(50) not null,
+    password varchar(100) not null,
+    user_active bool not null,
+    created_at TIMESTAMP NOT NULL default current_timestamp,
+    updated_at TIMESTAMP NOT NULL default current_timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_users_pagination ON users (created_at, id);
@@ -0,0 +1,9 @@
+-- keyset pages sorted by name (?sort=last_name) use idx_users_last_name
+CREATE INDEX IF NOT EXISTS idx_users_last_name ON users (last_name, id);
+-- trigram indexes behind the listing filters: email_domain and name_prefix use the
+-- per column ones, the free-text "q" search uses the one over the concatenation
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_first_name_trgm ON users USING gin (first_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_last_name_trgm ON users USING gin (last_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_search_trgm ON users USING gin ((first_name || ' ' || last_name || ' ' || email) gin_trgm_ops);
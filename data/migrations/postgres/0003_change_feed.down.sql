@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "user_tombstones";
+DROP INDEX IF EXISTS idx_users_changes;
@@ -0,0 +1,8 @@
+-- the change feed (/employees/changes) walks users by (updated_at, id), and learns about
+-- deleted users from the tombstones Delete leaves behind
+CREATE INDEX IF NOT EXISTS idx_users_changes ON users (updated_at, id);
+CREATE TABLE IF NOT EXISTS "user_tombstones" (
+    id VARCHAR(255) PRIMARY KEY NOT NULL,
+    deleted_at TIMESTAMP NOT NULL default current_timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_user_tombstones_changes ON user_tombstones (deleted_at, id);
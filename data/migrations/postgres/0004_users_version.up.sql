@@ -0,0 +1,3 @@
+-- every update bumps the version, which the API sends as the ETag of an employee and
+-- checks against If-Match
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
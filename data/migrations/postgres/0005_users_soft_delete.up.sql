@@ -0,0 +1,4 @@
+-- Delete only sets deleted_at, and the purge removes the rows once they are past the
+-- retention period. A deleted user keeps its email until then, so it can be restored.
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,12 @@
+-- ids are generated by Insert, and timestamps are stored as text in cursorTimeLayout
+create table if not exists users (
+    id varchar(255) primary key not null,
+    email varchar(50) unique not null,
+    first_name varchar(50) not null,
+    last_name varchar(50) not null,
+    password varchar(100) not null,
+    user_active bool not null,
+    created_at timestamp not null,
+    updated_at timestamp not null
+);
+create index if not exists idx_users_pagination on users (created_at, id);
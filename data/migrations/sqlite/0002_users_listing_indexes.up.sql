@@ -0,0 +1,2 @@
+-- sqlite has no trigram indexes, the listing filters scan the table
+create index if not exists idx_users_last_name on users (last_name, id);
@@ -0,0 +1,2 @@
+drop table if exists user_tombstones;
+drop index if exists idx_users_changes;
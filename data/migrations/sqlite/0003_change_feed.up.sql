@@ -0,0 +1,6 @@
+create index if not exists idx_users_changes on users (updated_at, id);
+create table if not exists user_tombstones (
+    id varchar(255) primary key not null,
+    deleted_at timestamp not null
+);
+create index if not exists idx_user_tombstones_changes on user_tombstones (deleted_at, id);
@@ -0,0 +1,3 @@
+-- every update bumps the version, which the API sends as the ETag of an employee and
+-- checks against If-Match
+alter table users add column version integer not null default 1;
@@ -0,0 +1,3 @@
+drop index if exists idx_users_deleted_at;
+delete from users where deleted_at is not null;
+alter table users drop column deleted_at;
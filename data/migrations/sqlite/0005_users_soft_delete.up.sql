@@ -0,0 +1,4 @@
+-- Delete only sets deleted_at, and the purge removes the rows once they are past the
+-- retention period. A deleted user keeps its email until then, so it can be restored.
+alter table users add column deleted_at timestamp;
+create index if not exists idx_users_deleted_at on users (deleted_at) where deleted_at is not null;
@@ -4,24 +4,42 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
+	"myRestAPIWithPagination/pagination"
 	"time"
 
-	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const dbTimeout = time.Second * 3
+// ErrDuplicate is returned by every storage when an insert or update would break a
+// unique constraint, i.e. the email is already taken.
+var ErrDuplicate = errors.New("provided value already exists")
 
-var db *sql.DB
+// ErrNotFound is returned by every storage when there is no user with the given id or
+// email.
+var ErrNotFound = errors.New("user not found")
 
 // New is the function used to create an instance of the data package. It returns the type
-// Model, which embeds all the types we want to be available to our application.
+// Model, which embeds all the types we want to be available to our application, backed by
+// the given postgres pool.
 func New(dbPool *sql.DB) Models {
-	db = dbPool
+	return Models{
+		User: NewPostgresUserRepository(dbPool),
+	}
+}
+
+// NewMemory returns the Models of the data package backed by in-memory storage, for local
+// development and tests.
+func NewMemory() Models {
+	return Models{
+		User: NewMemoryUserRepository(),
+	}
+}
 
+// NewSQLite returns the Models of the data package backed by the sqlite database db, as
+// opened by OpenSQLite.
+func NewSQLite(db *sql.DB) Models {
 	return Models{
-		User: User{},
+		User: NewSQLiteUserRepository(db),
 	}
 }
 
@@ -29,266 +47,91 @@ func New(dbPool *sql.DB) Models {
 // in this type is available to us throughout the application, anywhere that the
 // app variable is used, provided that the model is also added in the New function.
 type Models struct {
-	User User
+	User UserRepository
+}
+
+// UserRepository is the storage of users. The application only talks to users through
+// it, so the storage behind it can be swapped, or faked in tests.
+type UserRepository interface {
+	// GetAll returns a slice of all users, sorted by last name
+	GetAll() ([]*User, error)
+	// GetByEmail returns one user by email, or ErrNotFound
+	GetByEmail(email string) (*User, error)
+	// CheckId returns ErrNotFound if there is no user with the given id
+	CheckId(id string) error
+	// GetOne returns one user by id, or ErrNotFound
+	GetOne(id string) (*User, error)
+	// Insert inserts a new user, hashing its plain text password, and returns its id
+	Insert(user User) (string, error)
+	// BulkInsert inserts the users as they are, with their ids, timestamps and already
+	// hashed passwords, all of them or none. Empty ids are generated.
+	BulkInsert(users []User) error
+	// Import is BulkInsert skipping the users whose email is already taken, and reports
+	// them in duplicates. With allOrNothing, nothing is inserted if any is skipped. The
+	// users are created at the time of the insert, whatever times they come with.
+	Import(users []User, allOrNothing bool) (duplicates []bool, err error)
+	// Update updates the email, names and active flag of the user with user.ID, or
+	// returns ErrNotFound
+	Update(user User) error
+	// Patch reads the user with the given id, lets apply change it, and stores the
+	// fields that changed, all in one transaction. It returns the stored user, or
+	// ErrNotFound, or the error of apply.
+	Patch(id string, apply func(*User) error) (*User, error)
+	// Delete marks one user by id as deleted, leaving a tombstone for the change feed, or
+	// returns ErrNotFound. A non nil check is called with the user first, and an error of
+	// it keeps the user and is returned. Deleted users are left out everywhere, unless
+	// a listing asks for them, and keep their email until they are purged.
+	Delete(id string, check func(*User) error) error
+	// Restore undeletes the deleted user with the given id, or returns ErrNotFound if
+	// there is no such user, deleted or not. Restoring a user that isn't deleted does
+	// nothing.
+	Restore(id string) error
+	// Purge removes the users deleted before the given time for good, with their
+	// tombstones, and returns how many users there were
+	Purge(before time.Time) (int64, error)
+	// ResetPassword hashes and stores a new password for the user with the given id, or
+	// returns ErrNotFound
+	ResetPassword(id, password string) error
+	// GetAllForPagination returns a keyset page of users, see PostgresUserRepository
+	GetAllForPagination(filter Filter, sort pagination.Sort, cursor *pagination.Cursor, limit int) ([]*User, bool, error)
+	// GetPage returns an offset page of users
+	GetPage(filter Filter, sort pagination.Sort, offset, limit int) ([]*User, error)
+	// Export calls each with every user matching the filter, in the given sort order and
+	// without their password, without loading them all in memory. It stops at the first
+	// error of each, or when ctx is done.
+	Export(ctx context.Context, filter Filter, sort pagination.Sort, each func(*User) error) error
+	// Count returns the exact number of users matching the filter
+	Count(filter Filter) (int64, error)
+	// EstimateCount returns a cheap estimate of the number of users matching the filter
+	EstimateCount(filter Filter) (int64, error)
+	// GetChanges returns the next batch of the change feed after since, of the changes
+	// made before until
+	GetChanges(since *pagination.Cursor, until time.Time, limit int) ([]*Change, bool, error)
 }
 
 // User is the structure which holds one user from the database.
+// The password hash is never serialized; the API responds with its own view of a user.
 type User struct {
 	// ID        int    `json:"id"`
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	FirstName string `json:"first_name,omitempty"`
-	LastName  string `json:"last_name,omitempty"`
-	// Password  string    `json:"-"`
-	Password  string    `json:"password"`
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name,omitempty"`
+	LastName  string    `json:"last_name,omitempty"`
+	Password  string    `json:"-"`
 	Active    bool      `json:"user_active"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Version starts at 1 and goes up with every update
+	Version int64 `json:"version"`
+	// DeletedAt is set on the users deleted and not purged yet, which only the listings
+	// with Filter.IncludeDeleted return
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
-// GetAll returns a slice of all users, sorted by last name
-func (u *User) GetAll() ([]*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at
-	from users order by last_name`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []*User
-
-	for rows.Next() {
-		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.FirstName,
-			&user.LastName,
-			&user.Password,
-			&user.Active,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
-		if err != nil {
-			log.Info().Msgf("Error scanning: %v", err)
-			return nil, err
-		}
-
-		users = append(users, &user)
-	}
-
-	return users, nil
-}
-
-// GetByEmail returns one user by email
-func (u *User) GetByEmail(email string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = $1`
-	// query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = ($1)::uuid`
-	// query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = UUID(?)`
-
-	var user User
-	row := db.QueryRowContext(ctx, query, email)
-
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.Active,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
-// Check the provided user "id" does exist or not
-// func (u *User) CheckId(id string) error {
-// Since we're using uuid instead of int id in db
-func (u *User) CheckId(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	// query := `if exists(select * from users where id = $1)`
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1`
-
-	var user User
-	row := db.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.Active,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// GetOne returns one user by id
-// func (u *User) GetOne(id int) (*User, error) {
-// func (u *User) CheckId(id string) error {
-func (u *User) GetOne(id string) (*User, error) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1`
-
-	var user User
-	row := db.QueryRowContext(ctx, query, id)
-
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.FirstName,
-		&user.LastName,
-		&user.Password,
-		&user.Active,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
-// Update updates one user in the database, using the information
-// stored in the receiver u
-func (u *User) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `update users set
-		email = $1,
-		first_name = $2,
-		last_name = $3,
-		user_active = $4,
-		updated_at = $5
-		where id = $6
-	`
-
-	_, err := db.ExecContext(ctx, stmt,
-		u.Email,
-		u.FirstName,
-		u.LastName,
-		u.Active,
-		time.Now(),
-		u.ID,
-	)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Delete deletes one user from the database, by User.ID
-func (u *User) Delete() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, u.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// DeleteByID deletes one user from the database, by ID
-func (u *User) DeleteByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, id)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Insert inserts a new user into the database, and returns the ID of the newly inserted row
-func (u *User) Insert(user User) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
-	if err != nil {
-		return 0, err
-	}
-
-	var newID int
-	stmt := `insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7) returning id`
-
-	// if you create a unique key constraint on title & body columns, you can use insert statement as below to ignore if record
-	// already exists
-	// insert into posts(id, title, body) values (1, 'First post', 'Awesome') on conflict (title, body) do nothing;
-
-	err = db.QueryRowContext(ctx, stmt,
-		user.Email,
-		user.FirstName,
-		user.LastName,
-		hashedPassword,
-		user.Active,
-		time.Now(),
-		time.Now(),
-	).Scan(&newID)
-
-	if err != nil {
-		return 0, err
-	}
-
-	return newID, nil
-}
-
-// ResetPassword is the method we will use to change a user's password.
-func (u *User) ResetPassword(password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
-	if err != nil {
-		return err
-	}
-
-	stmt := `update users set password = $1 where id = $2`
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, u.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// HashPassword is how every storage hashes passwords, so that they all accept the same
+// credentials. Callers of BulkInsert and Import hash with it too.
+func HashPassword(plainText string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plainText), 12)
 }
 
 // PasswordMatches uses Go's bcrypt package to compare a user supplied password
@@ -308,78 +151,3 @@ func (u *User) PasswordMatches(plainText string) (bool, error) {
 
 	return true, nil
 }
-
-// GetAll returns a slice of all users, sorted by last name for pagination
-// It would require limit and cursor (timestamp)
-func (u *User) GetAllForPagination(cursorTime time.Time, cursorUUID string, isFirstQuery bool) ([]*User, error) {
-	// newTime := cursorTime
-	// if cursorTime == time.Now() {
-	// 	newTime = time.Date(1970, time.Month(1), 0, 0, 0, 0, 0, time.UTC) // epoch time: 1970, 1 January 00:00:00 UTC
-	// } else {
-	// 	newTime = cursorTime
-	// }
-
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	log.Info().Msgf("from GetAllForPagination: cursorTime:%v", cursorTime)
-
-	// query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at
-	// from users where created_at <= $1 and id < $2 order by created_at desc, id desc limit $3`
-	// query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at
-	// from users where created_at > $1 and id > $2 order by created_at desc, id desc limit $3`
-
-	var query string
-	var limit, offset int
-
-	newCursorTime := cursorTime.String()
-	newCursorTimeSlice := strings.Split(newCursorTime, "+")
-	newCursorTime = strings.TrimSpace(newCursorTimeSlice[0])
-
-	log.Info().Msgf("from GetAllForPagination: newCursorTime:%v", newCursorTime)
-
-	if isFirstQuery {
-		query = `select id, email, first_name, last_name, password, user_active, created_at, updated_at
-	from users where created_at > $1 order by created_at asc limit $2 offset $3`
-		limit = 10
-		offset = 0 // we can remove the offset totally as it's not needed now
-	} else {
-		query = `select id, email, first_name, last_name, password, user_active, created_at, updated_at
-	from users where created_at > $1 order by created_at asc limit $2 offset $3`
-		limit = 10
-		offset = 0 // we can remove the offset totally as it's not needed now
-	}
-
-	// rows, err := db.QueryContext(ctx, query, newTime, cursorUUID, 10) // Here 10 is limit. By default limit is 10 per page if no value provided
-	rows, err := db.QueryContext(ctx, query, newCursorTime, limit, offset) // Here 10 is limit. By default limit is 10 per page if no value provided
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []*User
-
-	for rows.Next() {
-		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.FirstName,
-			&user.LastName,
-			&user.Password,
-			&user.Active,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
-		if err != nil {
-			log.Info().Msgf("Error scanning: %v", err)
-			return nil, err
-		}
-
-		// Don't want to return the user's password so setting the value to "-"
-		user.Password = "-"
-		users = append(users, &user)
-	}
-
-	return users, nil
-}
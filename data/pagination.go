@@ -0,0 +1,215 @@
+package data
+
+import (
+	"fmt"
+	"myRestAPIWithPagination/pagination"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserKeyset is how users are ordered for pagination, over an allowlist of their
+// columns. The default sort by (created_at, id) is served by the idx_users_pagination
+// index.
+var UserKeyset = pagination.Keyset[*User]{
+	Columns: map[string]pagination.Kind{
+		"email":       pagination.String,
+		"first_name":  pagination.String,
+		"last_name":   pagination.String,
+		"created_at":  pagination.Time,
+		"updated_at":  pagination.Time,
+		"user_active": pagination.Bool,
+	},
+	Tiebreaker: "id",
+	Default:    pagination.Sort{{Column: "created_at"}},
+	Value: func(u *User, column string) any {
+		switch column {
+		case "email":
+			return u.Email
+		case "first_name":
+			return u.FirstName
+		case "last_name":
+			return u.LastName
+		case "created_at":
+			return u.CreatedAt
+		case "updated_at":
+			return u.UpdatedAt
+		case "user_active":
+			return u.Active
+		default:
+			return u.ID
+		}
+	},
+	TimeLayout: cursorTimeLayout,
+}
+
+// Filter narrows down the users returned by the listing. Zero values don't filter.
+type Filter struct {
+	Active        *bool
+	EmailDomain   string
+	NamePrefix    string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// Query is a free-text search over first_name, last_name and email.
+	Query string
+	// AsOf lists the users as they were at that moment, as far as which users there are
+	// goes: the users created after it are left out, and those deleted after it are kept.
+	// This is how snapshot traversals keep rows inserted or deleted while they run from
+	// shifting their later pages.
+	AsOf *time.Time
+	// IncludeDeleted adds the deleted users that aren't purged yet.
+	IncludeDeleted bool
+}
+
+// Key returns a canonical text form of the filter. Two filters selecting the same rows
+// have the same key, which is what cursors are bound to.
+func (f Filter) Key() string {
+	var parts []string
+
+	if f.Active != nil {
+		parts = append(parts, "user_active="+strconv.FormatBool(*f.Active))
+	}
+	if f.EmailDomain != "" {
+		parts = append(parts, "email_domain="+strings.ToLower(f.EmailDomain))
+	}
+	if f.NamePrefix != "" {
+		parts = append(parts, "name_prefix="+strings.ToLower(f.NamePrefix))
+	}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"created_after", f.CreatedAfter},
+		{"created_before", f.CreatedBefore},
+		{"updated_after", f.UpdatedAfter},
+		{"updated_before", f.UpdatedBefore},
+		{"as_of", f.AsOf},
+	} {
+		if bound.t != nil {
+			parts = append(parts, bound.name+"="+bound.t.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	if f.Query != "" {
+		parts = append(parts, "q="+strings.ToLower(f.Query))
+	}
+	if f.IncludeDeleted {
+		parts = append(parts, "include_deleted=true")
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// where returns the conditions of the filter, with placeholders numbered from $firstArg.
+// Text matching is case insensitive, with the like operator of the database, and backed
+// by the pg_trgm indexes on users in postgres.
+func (f Filter) where(firstArg int, like string) ([]string, []any) {
+	var conditions []string
+	var args []any
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$n", fmt.Sprintf("$%d", firstArg+len(args)-1)))
+	}
+	likeEscape := " " + like + ` $n escape '\'`
+
+	switch {
+	case f.IncludeDeleted:
+	case f.AsOf != nil:
+		add("(deleted_at is null or deleted_at > $n)", formatTime(*f.AsOf))
+	default:
+		conditions = append(conditions, "deleted_at is null")
+	}
+	if f.Active != nil {
+		add("user_active = $n", *f.Active)
+	}
+	if f.EmailDomain != "" {
+		add("email"+likeEscape, "%@"+escapeLike(f.EmailDomain))
+	}
+	if f.NamePrefix != "" {
+		add("(first_name"+likeEscape+" or last_name"+likeEscape+")", escapeLike(f.NamePrefix)+"%")
+	}
+	if f.CreatedAfter != nil {
+		add("created_at >= $n", formatTime(*f.CreatedAfter))
+	}
+	if f.CreatedBefore != nil {
+		add("created_at < $n", formatTime(*f.CreatedBefore))
+	}
+	if f.UpdatedAfter != nil {
+		add("updated_at >= $n", formatTime(*f.UpdatedAfter))
+	}
+	if f.UpdatedBefore != nil {
+		add("updated_at < $n", formatTime(*f.UpdatedBefore))
+	}
+	if f.AsOf != nil {
+		add("created_at <= $n", formatTime(*f.AsOf))
+	}
+	if f.Query != "" {
+		add("(first_name || ' ' || last_name || ' ' || email)"+likeEscape, "%"+escapeLike(f.Query)+"%")
+	}
+
+	return conditions, args
+}
+
+// matches reports whether the user passes the filter. It is the in-process equivalent of
+// where, for storages that filter rows themselves.
+func (f Filter) matches(u *User) bool {
+	if !f.IncludeDeleted && u.DeletedAt != nil && (f.AsOf == nil || !u.DeletedAt.After(*f.AsOf)) {
+		return false
+	}
+	if f.Active != nil && u.Active != *f.Active {
+		return false
+	}
+	if f.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(u.Email), "@"+strings.ToLower(f.EmailDomain)) {
+		return false
+	}
+	if f.NamePrefix != "" {
+		prefix := strings.ToLower(f.NamePrefix)
+		if !strings.HasPrefix(strings.ToLower(u.FirstName), prefix) && !strings.HasPrefix(strings.ToLower(u.LastName), prefix) {
+			return false
+		}
+	}
+	if f.CreatedAfter != nil && u.CreatedAt.Before(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && !u.CreatedAt.Before(*f.CreatedBefore) {
+		return false
+	}
+	if f.UpdatedAfter != nil && u.UpdatedAt.Before(*f.UpdatedAfter) {
+		return false
+	}
+	if f.UpdatedBefore != nil && !u.UpdatedAt.Before(*f.UpdatedBefore) {
+		return false
+	}
+	if f.AsOf != nil && u.CreatedAt.After(*f.AsOf) {
+		return false
+	}
+	if f.Query != "" {
+		text := strings.ToLower(u.FirstName + " " + u.LastName + " " + u.Email)
+		if !strings.Contains(text, strings.ToLower(f.Query)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckSnapshotSort returns an error unless a snapshot traversal can use the sort. Only
+// created_at never changes: under any other sort, a user updated while the client pages
+// would move to another page, and be skipped or listed twice.
+func CheckSnapshotSort(sort pagination.Sort) error {
+	for _, field := range sort {
+		if field.Column != "created_at" {
+			return fmt.Errorf("a snapshot can only be sorted by created_at, not by %s", field.Column)
+		}
+	}
+
+	return nil
+}
+
+// escapeLike escapes the wildcards of a like pattern, so user input only matches
+// literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+)
+
+// PostgresUserRepository is the UserRepository storing users in postgres, with the
+// schema from DatabaseQuery.SQL.
+type PostgresUserRepository struct {
+	sqlUserRepository
+}
+
+var _ UserRepository = (*PostgresUserRepository)(nil)
+
+var postgresDialect = dialect{
+	like:      "ilike",
+	forUpdate: " for update",
+	mapError:  mapPostgresError,
+}
+
+// NewPostgresUserRepository returns a UserRepository using the given pool.
+func NewPostgresUserRepository(dbPool *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{sqlUserRepository{DB: dbPool, dialect: postgresDialect}}
+}
+
+// mapPostgresError maps unique violations to ErrDuplicate.
+func mapPostgresError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	}
+
+	return err
+}
+
+// EstimateCount returns the planner's estimate of the number of users matching the
+// filter, which is cheap no matter how large the table is. Without a filter it is the
+// reltuples statistic of the table, less that of the partial index over the deleted
+// users unless they are included, otherwise the row estimate of the query plan.
+func (r *PostgresUserRepository) EstimateCount(filter Filter) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if filter == (Filter{}) || filter == (Filter{IncludeDeleted: true}) {
+		var users, deleted float64
+		err := r.DB.QueryRowContext(ctx, `select t.reltuples, coalesce(greatest(i.reltuples, 0), 0)
+			from pg_class t left join pg_class i on i.relname = 'idx_users_deleted_at'
+			where t.relname = 'users'`).Scan(&users, &deleted)
+		if err != nil {
+			return 0, err
+		}
+		if filter.IncludeDeleted {
+			deleted = 0
+		}
+
+		// reltuples is -1 until the table has been vacuumed or analyzed
+		if users >= 0 {
+			return max(int64(users-deleted), 0), nil
+		}
+	}
+
+	conditions, args := filter.where(1, r.dialect.like)
+
+	query := `explain (format json) select 1 from users`
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+
+	var plan []byte
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&plan)
+	if err != nil {
+		return 0, err
+	}
+
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return 0, err
+	}
+	if len(explained) == 0 {
+		return 0, errors.New("explain returned no plan")
+	}
+
+	return int64(explained[0].Plan.Rows), nil
+}
@@ -0,0 +1,480 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myRestAPIWithPagination/pagination"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStart is when the users of the tests are created, a minute apart.
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testUsers returns n active users, created a minute apart from testStart, with names
+// that sort the other way round from their creation.
+func testUsers(n int) []User {
+	users := make([]User, n)
+	for i := range users {
+		createdAt := testStart.Add(time.Duration(i) * time.Minute)
+		users[i] = User{
+			ID:        NewUUID(),
+			Email:     fmt.Sprintf("user%02d@example.com", i),
+			FirstName: fmt.Sprintf("First%02d", i),
+			LastName:  fmt.Sprintf("Last%02d", n-i),
+			Password:  "hash",
+			Active:    i%2 == 0,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+	}
+
+	return users
+}
+
+// emails returns the emails of the users, in their order.
+func emails(users []*User) []string {
+	var emails []string
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+
+	return emails
+}
+
+// testUserRepository runs the behaviour every UserRepository shares against the ones
+// newRepository returns, an empty one for every test.
+func testUserRepository(t *testing.T, newRepository func(t *testing.T) UserRepository) {
+	seeded := func(t *testing.T, n int) (UserRepository, []User) {
+		t.Helper()
+
+		repository := newRepository(t)
+		users := testUsers(n)
+		if err := repository.BulkInsert(users); err != nil {
+			t.Fatal(err)
+		}
+
+		return repository, users
+	}
+
+	t.Run("Insert", func(t *testing.T) {
+		repository := newRepository(t)
+
+		id, err := repository.Insert(User{Email: "alice@example.com", FirstName: "Alice", LastName: "Smith", Password: "secret123", Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repository.GetOne(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "alice@example.com" || user.FirstName != "Alice" || !user.Active || user.Version != 1 || user.CreatedAt.IsZero() || !user.UpdatedAt.Equal(user.CreatedAt) {
+			t.Errorf("GetOne() = %+v", user)
+		}
+
+		byEmail, err := repository.GetByEmail("alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matches, err := byEmail.PasswordMatches("secret123"); err != nil || !matches {
+			t.Errorf("the password of the user doesn't match: %v", err)
+		}
+
+		if _, err := repository.Insert(User{Email: "alice@example.com", Password: "secret123"}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Insert() of a taken email error = %v, want ErrDuplicate", err)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repository, _ := seeded(t, 1)
+		missing := NewUUID()
+
+		if _, err := repository.GetOne(missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetOne() error = %v, want ErrNotFound", err)
+		}
+		if err := repository.CheckId(missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("CheckId() error = %v, want ErrNotFound", err)
+		}
+		if _, err := repository.GetByEmail("nobody@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByEmail() error = %v, want ErrNotFound", err)
+		}
+		if err := repository.Update(User{ID: missing, Email: "nobody@example.com"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update() error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repository, users := seeded(t, 2)
+
+		changed := users[0]
+		changed.Email = "renamed@example.com"
+		changed.LastName = "Renamed"
+		changed.Active = false
+		if err := repository.Update(changed); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := repository.GetOne(changed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "renamed@example.com" || user.LastName != "Renamed" || user.Active || user.Version != 2 || !user.UpdatedAt.After(user.CreatedAt) {
+			t.Errorf("the updated user is %+v", user)
+		}
+
+		changed.Email = users[1].Email
+		if err := repository.Update(changed); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Update() to a taken email error = %v, want ErrDuplicate", err)
+		}
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		repository, users := seeded(t, 2)
+
+		patched, err := repository.Patch(users[0].ID, func(user *User) error {
+			user.FirstName = "Patched"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if patched.FirstName != "Patched" || patched.Version != 2 {
+			t.Errorf("Patch() = %+v", patched)
+		}
+
+		refused := errors.New("refused")
+		_, err = repository.Patch(users[0].ID, func(user *User) error {
+			user.FirstName = "Refused"
+			return refused
+		})
+		if !errors.Is(err, refused) {
+			t.Errorf("Patch() error = %v, want the error of apply", err)
+		}
+		if stored, _ := repository.GetOne(users[0].ID); stored.FirstName != "Patched" || stored.Version != 2 {
+			t.Errorf("a refused patch stored %+v", stored)
+		}
+
+		_, err = repository.Patch(users[0].ID, func(user *User) error {
+			user.Email = users[1].Email
+			return nil
+		})
+		if !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Patch() to a taken email error = %v, want ErrDuplicate", err)
+		}
+		if _, err := repository.Patch(NewUUID(), func(*User) error { return nil }); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Patch() of a missing user error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		repository, users := seeded(t, 1)
+		before := time.Now().Add(-time.Millisecond)
+
+		imported := testUsers(3)[1:]
+		imported[0].ID = ""
+		imported = append(imported, User{Email: users[0].Email, Password: "hash"}, User{Email: imported[1].Email, Password: "hash"})
+
+		duplicates, err := repository.Import(imported, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []bool{false, false, true, true}; !slices.Equal(duplicates, want) {
+			t.Errorf("Import() duplicates = %v, want %v", duplicates, want)
+		}
+		if count, _ := repository.Count(Filter{}); count != 1 {
+			t.Fatalf("an import all or nothing with duplicates stored %d users", count-1)
+		}
+
+		if _, err := repository.Import(imported, false); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := repository.GetByEmail(imported[0].Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.ID == "" || stored.CreatedAt.Before(before) || !stored.UpdatedAt.Equal(stored.CreatedAt) {
+			t.Errorf("the imported user is %+v, want it created by the import", stored)
+		}
+		if count, _ := repository.Count(Filter{}); count != 3 {
+			t.Errorf("the import stored %d users, want 2", count-1)
+		}
+	})
+
+	t.Run("ResetPassword", func(t *testing.T) {
+		repository, users := seeded(t, 1)
+
+		if err := repository.ResetPassword(users[0].ID, "newsecret1"); err != nil {
+			t.Fatal(err)
+		}
+		user, err := repository.GetByEmail(users[0].Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matches, _ := user.PasswordMatches("newsecret1"); !matches {
+			t.Error("the new password doesn't match")
+		}
+
+		if err := repository.ResetPassword(NewUUID(), "newsecret1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ResetPassword() of a missing user error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("DeleteRestorePurge", func(t *testing.T) {
+		repository, users := seeded(t, 3)
+		deleted := users[0].ID
+
+		refused := errors.New("refused")
+		if err := repository.Delete(deleted, func(*User) error { return refused }); !errors.Is(err, refused) {
+			t.Errorf("Delete() error = %v, want the error of check", err)
+		}
+		if err := repository.CheckId(deleted); err != nil {
+			t.Errorf("a refused delete removed the user: %v", err)
+		}
+
+		if err := repository.Delete(deleted, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repository.GetOne(deleted); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetOne() of a deleted user error = %v, want ErrNotFound", err)
+		}
+		if err := repository.ResetPassword(deleted, "newsecret1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ResetPassword() of a deleted user error = %v, want ErrNotFound", err)
+		}
+		if err := repository.Delete(NewUUID(), nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete() of a missing user error = %v, want ErrNotFound", err)
+		}
+		if count, err := repository.Count(Filter{}); err != nil || count != 2 {
+			t.Errorf("Count() = %d, %v, want 2", count, err)
+		}
+		if count, err := repository.Count(Filter{IncludeDeleted: true}); err != nil || count != 3 {
+			t.Errorf("Count() with the deleted users = %d, %v, want 3", count, err)
+		}
+
+		if err := repository.Restore(deleted); err != nil {
+			t.Fatal(err)
+		}
+		if user, err := repository.GetOne(deleted); err != nil || user.DeletedAt != nil {
+			t.Errorf("the restored user is %+v, %v", user, err)
+		}
+		if err := repository.Restore(NewUUID()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Restore() of a missing user error = %v, want ErrNotFound", err)
+		}
+
+		if err := repository.Delete(deleted, nil); err != nil {
+			t.Fatal(err)
+		}
+		if purged, err := repository.Purge(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("Purge() before the delete = %d, %v, want 0", purged, err)
+		}
+		if purged, err := repository.Purge(time.Now().Add(time.Second)); err != nil || purged != 1 {
+			t.Errorf("Purge() = %d, %v, want 1", purged, err)
+		}
+		if count, _ := repository.Count(Filter{IncludeDeleted: true}); count != 2 {
+			t.Errorf("%d users are left after the purge, want 2", count)
+		}
+		if err := repository.Restore(deleted); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Restore() of a purged user error = %v, want ErrNotFound", err)
+		}
+
+		changes, _, err := repository.GetChanges(nil, time.Now().Add(time.Second), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.ContainsFunc(changes, func(change *Change) bool { return change.ID == deleted }) {
+			t.Errorf("the change feed still lists the purged user: %+v", changes)
+		}
+	})
+
+	t.Run("GetAll", func(t *testing.T) {
+		repository, _ := seeded(t, 3)
+
+		users, err := repository.GetAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := emails(users), []string{"user02@example.com", "user01@example.com", "user00@example.com"}; !slices.Equal(got, want) {
+			t.Errorf("GetAll() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("GetAllForPagination", func(t *testing.T) {
+		repository, _ := seeded(t, 7)
+
+		for _, spec := range []string{"", "-created_at", "last_name", "user_active,-email"} {
+			sort, err := UserKeyset.ParseSort(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			all, hasMore, err := repository.GetAllForPagination(Filter{}, sort, nil, 100)
+			if err != nil || hasMore || len(all) != 7 {
+				t.Fatalf("sort %q: a page of 100 has %d users, has more %v, error %v", spec, len(all), hasMore, err)
+			}
+
+			// forward three at a time, then back from the last page
+			var forward []*User
+			var cursor *pagination.Cursor
+			for {
+				page, hasMore, err := repository.GetAllForPagination(Filter{}, sort, cursor, 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+				forward = append(forward, page...)
+				if !hasMore {
+					break
+				}
+				cursor = &pagination.Cursor{Values: cursorValues(sort, page[len(page)-1])}
+			}
+			if !slices.Equal(emails(forward), emails(all)) {
+				t.Errorf("sort %q: pages of 3 list %v, want %v", spec, emails(forward), emails(all))
+			}
+
+			back := &pagination.Cursor{Values: cursorValues(sort, all[len(all)-1]), Backward: true}
+			page, hasMore, err := repository.GetAllForPagination(Filter{}, sort, back, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := emails(all[3:6]); !slices.Equal(emails(page), want) || !hasMore {
+				t.Errorf("sort %q: the page before the last user lists %v, has more %v, want %v", spec, emails(page), hasMore, want)
+			}
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		repository, _ := seeded(t, 6)
+		active := true
+		after := testStart.Add(2 * time.Minute)
+
+		tests := []struct {
+			name   string
+			filter Filter
+			want   []string
+		}{
+			{"active", Filter{Active: &active}, []string{"user00@example.com", "user02@example.com", "user04@example.com"}},
+			{"created after", Filter{CreatedAfter: &after, Active: &active}, []string{"user02@example.com", "user04@example.com"}},
+			{"name prefix", Filter{NamePrefix: "first0"}, []string{"user00@example.com", "user01@example.com", "user02@example.com", "user03@example.com", "user04@example.com", "user05@example.com"}},
+			{"query", Filter{Query: "R03@EXAMPLE"}, []string{"user03@example.com"}},
+			{"escaped query", Filter{Query: "user_0"}, nil},
+			{"email domain", Filter{EmailDomain: "other.example"}, nil},
+		}
+
+		for _, tt := range tests {
+			users, _, err := repository.GetAllForPagination(tt.filter, UserKeyset.Default, nil, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := emails(users); !slices.Equal(got, tt.want) {
+				t.Errorf("%s: GetAllForPagination() = %v, want %v", tt.name, got, tt.want)
+			}
+
+			count, err := repository.Count(tt.filter)
+			if err != nil || count != int64(len(tt.want)) {
+				t.Errorf("%s: Count() = %d, %v, want %d", tt.name, count, err, len(tt.want))
+			}
+		}
+	})
+
+	t.Run("GetPage", func(t *testing.T) {
+		repository, users := seeded(t, 5)
+
+		page, err := repository.GetPage(Filter{}, UserKeyset.Default, 3, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := emails(page), []string{users[3].Email, users[4].Email}; !slices.Equal(got, want) {
+			t.Errorf("GetPage() = %v, want %v", got, want)
+		}
+
+		if page, err := repository.GetPage(Filter{}, UserKeyset.Default, 10, 3); err != nil || len(page) != 0 {
+			t.Errorf("GetPage() past the end = %v, %v", emails(page), err)
+		}
+		if _, err := repository.GetPage(Filter{}, UserKeyset.Default, -3, 3); err == nil {
+			t.Error("GetPage() at a negative offset succeeded")
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		repository, users := seeded(t, 5)
+		sort, _ := UserKeyset.ParseSort("-created_at")
+
+		var exported []*User
+		err := repository.Export(context.Background(), Filter{}, sort, func(user *User) error {
+			if user.Password != "" {
+				t.Errorf("%s is exported with a password", user.Email)
+			}
+			exported = append(exported, user)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := emails(exported), []string{users[4].Email, users[3].Email, users[2].Email, users[1].Email, users[0].Email}; !slices.Equal(got, want) {
+			t.Errorf("Export() = %v, want %v", got, want)
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err = repository.Export(context.Background(), Filter{}, sort, func(*User) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("Export() after an error of each = %v, with %d calls", err, calls)
+		}
+	})
+
+	t.Run("EstimateCount", func(t *testing.T) {
+		repository, _ := seeded(t, 4)
+
+		if count, err := repository.EstimateCount(Filter{}); err != nil || count < 0 {
+			t.Errorf("EstimateCount() = %d, %v", count, err)
+		}
+	})
+
+	t.Run("GetChanges", func(t *testing.T) {
+		repository, users := seeded(t, 3)
+		until := time.Now()
+
+		changes, hasMore, err := repository.GetChanges(nil, until, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 2 || !hasMore || changes[0].Type != ChangeCreated || changes[0].ID != users[0].ID || changes[0].User == nil {
+			t.Fatalf("the first changes are %+v, has more %v", changes, hasMore)
+		}
+
+		since := &pagination.Cursor{Values: []any{changes[1].ChangedAt, changes[1].ID}}
+
+		changed := users[0]
+		changed.LastName = "Changed"
+		if err := repository.Update(changed); err != nil {
+			t.Fatal(err)
+		}
+
+		changes, hasMore, err = repository.GetChanges(since, time.Now().Add(time.Second), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 2 || hasMore || changes[0].ID != users[2].ID || changes[0].Type != ChangeCreated || changes[1].ID != users[0].ID || changes[1].Type != ChangeUpdated {
+			t.Errorf("the changes since the second user are %+v, has more %v", changes, hasMore)
+		}
+
+		// the update isn't before until
+		if changes, _, err := repository.GetChanges(since, until, 10); err != nil || len(changes) != 1 {
+			t.Errorf("the changes until before the update are %+v, %v", changes, err)
+		}
+	})
+}
+
+// cursorValues returns the values of a cursor positioned at the user.
+func cursorValues(sort pagination.Sort, user *User) []any {
+	cursor, err := UserKeyset.ParseCursor(sort, UserKeyset.Keys(sort, user), false)
+	if err != nil {
+		panic(err)
+	}
+
+	return cursor.Values
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+var (
+	seedFirstNames = []string{
+		"Ada", "Alan", "Barbara", "Claude", "Dennis", "Edsger", "Frances", "Grace", "Hedy", "Ivan",
+		"John", "Ken", "Leslie", "Margaret", "Niklaus", "Radia", "Rob", "Sophie", "Tim", "Yukihiro",
+	}
+	seedLastNames = []string{
+		"Allen", "Backus", "Dijkstra", "Hamilton", "Hopper", "Kernighan", "Knuth", "Lamport", "Liskov", "Lovelace",
+		"Matsumoto", "McCarthy", "Perlman", "Pike", "Ritchie", "Shannon", "Sutherland", "Thompson", "Turing", "Wirth",
+	}
+	seedDomains = []string{"example.com", "example.org", "acme.test", "globex.test", "initech.test"}
+)
+
+// seedEmailLength is the length of the email column, which generated emails fit in.
+const seedEmailLength = 50
+
+// SeedOptions describes the users GenerateUsers makes up.
+type SeedOptions struct {
+	// Seed makes the generated users, ids included, the same from run to run
+	Seed uint64
+	// Count is the number of users
+	Count int
+	// Password is the password of every user, hashed once for all of them
+	Password string
+	// Start and Span are the range the created_at of the users are spread over
+	Start time.Time
+	Span  time.Duration
+	// Duplicates is the share of users created at exactly the same time as another one,
+	// so keyset pages have to fall back on the id tiebreaker
+	Duplicates float64
+	// Active is the share of active users
+	Active float64
+}
+
+// DefaultSeedOptions returns options generating users over the year 2024, a fifth of
+// them sharing their created_at with another user.
+func DefaultSeedOptions() SeedOptions {
+	return SeedOptions{
+		Seed:       1,
+		Count:      1000,
+		Password:   "secret123",
+		Start:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Span:       365 * 24 * time.Hour,
+		Duplicates: 0.2,
+		Active:     0.8,
+	}
+}
+
+// GenerateUsers makes up users for development and benchmarks, ready for BulkInsert.
+// Everything but the password hash is derived from the seed, so the same options give
+// the same users, in the same order. Emails carry the seed, so datasets generated with
+// different seeds can be inserted side by side. Names too long for the email column are
+// cut short in it.
+func GenerateUsers(options SeedOptions) ([]User, error) {
+	if options.Count < 0 {
+		return nil, fmt.Errorf("can't generate %d users", options.Count)
+	}
+	if options.Span < 0 || options.Duplicates < 0 || options.Duplicates > 1 || options.Active < 0 || options.Active > 1 {
+		return nil, fmt.Errorf("invalid seed options %+v", options)
+	}
+
+	hashedPassword, err := HashPassword(options.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewPCG(options.Seed, options.Seed^0x5eed))
+	start := options.Start.UTC().Truncate(time.Microsecond)
+
+	users := make([]User, 0, options.Count)
+	for i := 0; i < options.Count; i++ {
+		firstName := seedFirstNames[rng.IntN(len(seedFirstNames))]
+		lastName := seedLastNames[rng.IntN(len(seedLastNames))]
+		domain := seedDomains[rng.IntN(len(seedDomains))]
+
+		var createdAt time.Time
+		if len(users) > 0 && rng.Float64() < options.Duplicates {
+			createdAt = users[rng.IntN(len(users))].CreatedAt
+		} else {
+			createdAt = start.Add(randomDuration(rng, options.Span)).Truncate(time.Microsecond)
+		}
+
+		// half of the users were never updated
+		updatedAt := createdAt
+		if rng.IntN(2) == 0 {
+			updatedAt = createdAt.Add(randomDuration(rng, start.Add(options.Span).Sub(createdAt))).Truncate(time.Microsecond)
+		}
+
+		users = append(users, User{
+			ID:        seedUUID(rng),
+			Email:     seedEmail(firstName, lastName, options.Seed, i+1, domain),
+			FirstName: firstName,
+			LastName:  lastName,
+			Password:  string(hashedPassword),
+			Active:    rng.Float64() < options.Active,
+			CreatedAt: createdAt,
+			UpdatedAt: updatedAt,
+		})
+	}
+
+	return users, nil
+}
+
+// seedEmail returns the email of the nth user generated with seed, keeping the seed, n
+// and domain whole, so emails stay unique, and cutting the name short to fit the column.
+func seedEmail(firstName, lastName string, seed uint64, n int, domain string) string {
+	name := strings.ToLower(firstName + "." + lastName)
+	suffix := fmt.Sprintf(".%d-%d@%s", seed, n, domain)
+
+	// a cut right after the dot would leave two dots in a row
+	name = strings.TrimRight(name[:min(len(name), max(seedEmailLength-len(suffix), 1))], ".")
+
+	return name + suffix
+}
+
+// randomDuration returns a duration in [0, span).
+func randomDuration(rng *rand.Rand, span time.Duration) time.Duration {
+	if span <= 0 {
+		return 0
+	}
+
+	return time.Duration(rng.Int64N(int64(span)))
+}
+
+// seedUUID returns a version 4 UUID drawn from rng, like NewUUID.
+func seedUUID(rng *rand.Rand) string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(rng.Uint32())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"math"
+	"myRestAPIWithPagination/validation"
+	"testing"
+	"time"
+)
+
+func TestGenerateUsers(t *testing.T) {
+	options := DefaultSeedOptions()
+	options.Count = 500
+
+	users, err := GenerateUsers(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := GenerateUsers(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails := map[string]bool{}
+	createdAt := map[time.Time]bool{}
+	shared := 0
+	for i, user := range users {
+		other := again[i]
+		if user.ID != other.ID || user.Email != other.Email || user.FirstName != other.FirstName || !user.CreatedAt.Equal(other.CreatedAt) || !user.UpdatedAt.Equal(other.UpdatedAt) || user.Active != other.Active {
+			t.Fatalf("user %d differs from one run to the next: %+v and %+v", i, user, other)
+		}
+
+		if emails[user.Email] {
+			t.Errorf("the email %s is generated twice", user.Email)
+		}
+		emails[user.Email] = true
+
+		if user.CreatedAt.Before(options.Start) || !user.CreatedAt.Before(options.Start.Add(options.Span)) || user.UpdatedAt.Before(user.CreatedAt) {
+			t.Errorf("user %d is created at %s and updated at %s", i, user.CreatedAt, user.UpdatedAt)
+		}
+		if createdAt[user.CreatedAt] {
+			shared++
+		}
+		createdAt[user.CreatedAt] = true
+	}
+
+	// a fifth of them share their created_at, give or take
+	if shared < options.Count/10 || shared > options.Count*3/10 {
+		t.Errorf("%d of %d users share their created_at with another one", shared, options.Count)
+	}
+
+	if matches, err := users[0].PasswordMatches(options.Password); err != nil || !matches {
+		t.Errorf("the users don't have the password %q: %v", options.Password, err)
+	}
+	if errs := validation.Var("password", options.Password, "password"); errs != nil {
+		t.Errorf("the default password isn't one the API accepts: %v", errs)
+	}
+
+	options.Seed = 2
+	other, err := GenerateUsers(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range other {
+		if emails[user.Email] {
+			t.Errorf("the email %s is generated with both seeds", user.Email)
+		}
+	}
+}
+
+func TestSeedEmailFitsTheColumn(t *testing.T) {
+	for _, n := range []int{1, 1_000_000, math.MaxInt32} {
+		email := seedEmail("Yukihiro", "Sutherland", math.MaxUint64, n, "initech.test")
+		if errs := validation.Var("email", email, "email,max=50"); errs != nil {
+			t.Errorf("seedEmail() = %q: %v", email, errs)
+		}
+	}
+
+	if email := seedEmail("Ada", "Pike", 1, 2, "acme.test"); email != "ada.pike.1-2@acme.test" {
+		t.Errorf("seedEmail() = %q, want the whole name", email)
+	}
+}
+
+func TestGenerateUsersRefusesInvalidOptions(t *testing.T) {
+	for _, options := range []SeedOptions{
+		{Count: -1},
+		{Count: 1, Span: -time.Hour},
+		{Count: 1, Duplicates: 2},
+		{Count: 1, Active: -0.5},
+	} {
+		if _, err := GenerateUsers(options); err == nil {
+			t.Errorf("GenerateUsers(%+v) succeeded", options)
+		}
+	}
+}
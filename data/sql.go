@@ -0,0 +1,981 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"myRestAPIWithPagination/pagination"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const dbTimeout = time.Second * 3
+
+// bulkTimeout bounds the single transaction of a BulkInsert.
+const bulkTimeout = time.Minute * 5
+
+// bulkBatchSize is the number of rows per insert statement of a BulkInsert, keeping the
+// placeholders well below the limits of postgres and sqlite.
+const bulkBatchSize = 1000
+
+// cursorTimeLayout is the layout timestamps are passed to the database with. It keeps the
+// full microsecond precision of the timestamp columns, but drops the zone, which the
+// "timestamp without time zone" columns don't have. Its text compares in time order,
+// which is what sqlite relies on.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// dialect is what differs between the SQL databases users can be stored in.
+type dialect struct {
+	// like is the case insensitive like operator
+	like string
+	// forUpdate locks the rows a select reads for the rest of the transaction, where the
+	// database has row locks
+	forUpdate string
+	// mapError turns the driver errors the application handles into the errors of this
+	// package, keeping the original error wrapped.
+	mapError func(error) error
+}
+
+// sqlUserRepository is the UserRepository shared by the SQL storages. The queries are
+// written for postgres, and kept to what sqlite understands as well.
+type sqlUserRepository struct {
+	DB      *sql.DB
+	dialect dialect
+}
+
+// formatTime returns a time the way it is stored, see cursorTimeLayout.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(cursorTimeLayout)
+}
+
+// scanNullTime is scanTime for a nullable timestamp, leaving nil for null.
+type scanNullTime struct {
+	t **time.Time
+}
+
+func (s scanNullTime) Scan(src any) error {
+	if src == nil {
+		*s.t = nil
+		return nil
+	}
+
+	var t time.Time
+	if err := (scanTime{&t}).Scan(src); err != nil {
+		return err
+	}
+	*s.t = &t
+
+	return nil
+}
+
+// scanTime lets rows.Scan read a timestamp whether the driver returns it as a time.Time
+// or, like sqlite does for the columns of a union, as text.
+type scanTime struct {
+	t *time.Time
+}
+
+func (s scanTime) Scan(src any) error {
+	var text string
+
+	switch src := src.(type) {
+	case time.Time:
+		*s.t = src
+		return nil
+	case string:
+		text = src
+	case []byte:
+		text = string(src)
+	default:
+		return fmt.Errorf("can't scan %T into a time", src)
+	}
+
+	t, err := time.Parse(cursorTimeLayout, text)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339Nano, text)
+	}
+	if err != nil {
+		return err
+	}
+
+	*s.t = t
+
+	return nil
+}
+
+// GetAll returns a slice of all users, sorted by last name
+func (r *sqlUserRepository) GetAll() ([]*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version
+	from users where deleted_at is null order by last_name`
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.Active,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Version,
+		)
+		if err != nil {
+			log.Info().Msgf("Error scanning: %v", err)
+			return nil, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, nil
+}
+
+// GetByEmail returns one user by email
+func (r *sqlUserRepository) GetByEmail(email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version from users where email = $1 and deleted_at is null`
+	// query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = ($1)::uuid`
+	// query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = UUID(?)`
+
+	var user User
+	row := r.DB.QueryRowContext(ctx, query, email)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Check the provided user "id" does exist or not
+// func (u *User) CheckId(id string) error {
+// Since we're using uuid instead of int id in db
+func (r *sqlUserRepository) CheckId(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// query := `if exists(select * from users where id = $1)`
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version from users where id = $1 and deleted_at is null`
+
+	var user User
+	row := r.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetOne returns one user by id
+// func (u *User) GetOne(id int) (*User, error) {
+// func (u *User) CheckId(id string) error {
+func (r *sqlUserRepository) GetOne(id string) (*User, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version from users where id = $1 and deleted_at is null`
+
+	var user User
+	row := r.DB.QueryRowContext(ctx, query, id)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Update updates one user in the database, using the information
+// stored in user
+func (r *sqlUserRepository) Update(user User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set
+		email = $1,
+		first_name = $2,
+		last_name = $3,
+		user_active = $4,
+		updated_at = $5,
+		version = version + 1
+		where id = $6 and deleted_at is null
+	`
+
+	result, err := r.DB.ExecContext(ctx, stmt,
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		user.Active,
+		formatTime(now()),
+		user.ID,
+	)
+
+	if err != nil {
+		return r.dialect.mapError(err)
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Patch reads the user with the given id, lets apply change it, and writes back only the
+// columns that changed, all in one transaction, so no other update can come in between.
+// Nothing is written when nothing changed.
+func (r *sqlUserRepository) Patch(id string, apply func(*User) error) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user, err := r.lockUser(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	patched := *user
+	if err := apply(&patched); err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	var args []any
+	for _, field := range []struct {
+		column  string
+		changed bool
+		value   any
+	}{
+		{"email", patched.Email != user.Email, patched.Email},
+		{"first_name", patched.FirstName != user.FirstName, patched.FirstName},
+		{"last_name", patched.LastName != user.LastName, patched.LastName},
+		{"user_active", patched.Active != user.Active, patched.Active},
+	} {
+		if field.changed {
+			args = append(args, field.value)
+			columns = append(columns, fmt.Sprintf("%s = $%d", field.column, len(args)))
+		}
+	}
+	if len(columns) == 0 {
+		return user, tx.Commit()
+	}
+
+	patched.UpdatedAt = now()
+	patched.Version = user.Version + 1
+	args = append(args, formatTime(patched.UpdatedAt), id)
+	stmt := fmt.Sprintf(`update users set %s, updated_at = $%d, version = version + 1 where id = $%d`,
+		strings.Join(columns, ", "), len(args)-1, len(args))
+
+	_, err = tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, r.dialect.mapError(err)
+	}
+
+	return &patched, tx.Commit()
+}
+
+// lockUser reads one user by id inside tx, locking its row until tx ends where the
+// database has row locks.
+func (r *sqlUserRepository) lockUser(ctx context.Context, tx *sql.Tx, id string) (*User, error) {
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version
+		from users where id = $1 and deleted_at is null` + r.dialect.forUpdate
+
+	var user User
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Delete marks one user of the database as deleted, by ID, until Purge removes it. A
+// tombstone is left behind in the same transaction, so the change feed can tell sync
+// clients about the deletion. With a check, the user is read first, and kept if check
+// fails.
+func (r *sqlUserRepository) Delete(id string, check func(*User) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if check != nil {
+		user, err := r.lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := check(user); err != nil {
+			return err
+		}
+	}
+
+	deletedAt := formatTime(now())
+
+	stmt := `update users set deleted_at = $1 where id = $2 and deleted_at is null`
+
+	result, err := tx.ExecContext(ctx, stmt, deletedAt, id)
+	if err != nil {
+		return err
+	}
+
+	// without a user there is nothing to leave a tombstone for
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	stmt = `insert into user_tombstones (id, deleted_at) values ($1, $2)
+		on conflict (id) do update set deleted_at = excluded.deleted_at`
+
+	_, err = tx.ExecContext(ctx, stmt, id, deletedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore clears the deleted_at of a user, and removes its tombstone in the same
+// transaction. The restore counts as an update, so the change feed sends the user again.
+func (r *sqlUserRepository) Restore(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update users set deleted_at = null, updated_at = $1, version = version + 1
+		where id = $2 and deleted_at is not null`
+
+	result, err := tx.ExecContext(ctx, stmt, formatTime(now()), id)
+	if err != nil {
+		return err
+	}
+
+	restored, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if restored == 0 {
+		// either the user isn't deleted, which is fine, or there is no such user
+		var exists bool
+		err := tx.QueryRowContext(ctx, `select true from users where id = $1`, id).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from user_tombstones where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Purge deletes the users deleted before the given time, and their tombstones with them
+// in the same transaction. Sync clients further behind than that have to start over.
+func (r *sqlUserRepository) Purge(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `delete from users where deleted_at < $1`, formatTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from user_tombstones where deleted_at < $1`, formatTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+// Insert inserts a new user into the database, and returns the ID of the newly inserted row
+func (r *sqlUserRepository) Insert(user User) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	hashedPassword, err := HashPassword(user.Password)
+	if err != nil {
+		return "", err
+	}
+
+	var newID string
+	stmt := `insert into users (id, email, first_name, last_name, password, user_active, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	// if you create a unique key constraint on title & body columns, you can use insert statement as below to ignore if record
+	// already exists
+	// insert into posts(id, title, body) values (1, 'First post', 'Awesome') on conflict (title, body) do nothing;
+
+	// the id is generated here rather than by the database, since sqlite has no
+	// uuid_generate_v4()
+	createdAt := formatTime(now())
+
+	err = r.DB.QueryRowContext(ctx, stmt,
+		NewUUID(),
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		string(hashedPassword),
+		user.Active,
+		createdAt,
+		createdAt,
+	).Scan(&newID)
+
+	if err != nil {
+		return "", r.dialect.mapError(err)
+	}
+
+	return newID, nil
+}
+
+// BulkInsert inserts the users as they are, in batches of multi-row insert statements
+// within one transaction, so either all of them are inserted or none.
+func (r *sqlUserRepository) BulkInsert(users []User) error {
+	_, err := r.bulkInsert(users, false, false)
+
+	return err
+}
+
+// Import inserts the users like BulkInsert, except that rows whose email is taken are
+// skipped by "on conflict do nothing", and told apart by the emails the inserts return,
+// and that the users are stamped as created when the transaction starts.
+func (r *sqlUserRepository) Import(users []User, allOrNothing bool) ([]bool, error) {
+	return r.bulkInsert(users, true, allOrNothing)
+}
+
+// bulkInsert inserts users in one transaction. With skipDuplicates, users whose email is
+// taken are skipped and reported, and the transaction is rolled back if allOrNothing.
+// Skipping duplicates is what imports do, and imported users are created at the time
+// taken in the transaction rather than the one they come with, so the change feed lag
+// covers them.
+func (r *sqlUserRepository) bulkInsert(users []User, skipDuplicates, allOrNothing bool) ([]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	duplicates := make([]bool, len(users))
+	skipped := false
+	importedAt := now()
+
+	for start := 0; start < len(users); start += bulkBatchSize {
+		batch := users[start:min(start+bulkBatchSize, len(users))]
+
+		values := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*8)
+		for _, user := range batch {
+			id := user.ID
+			if id == "" {
+				id = NewUUID()
+			}
+			if skipDuplicates {
+				user.CreatedAt = importedAt
+				user.UpdatedAt = importedAt
+			}
+
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+			args = append(args,
+				id,
+				user.Email,
+				user.FirstName,
+				user.LastName,
+				user.Password,
+				user.Active,
+				formatTime(user.CreatedAt),
+				formatTime(user.UpdatedAt),
+			)
+		}
+
+		stmt := `insert into users (id, email, first_name, last_name, password, user_active, created_at, updated_at)
+		values ` + strings.Join(values, ", ")
+
+		if !skipDuplicates {
+			if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+				return nil, r.dialect.mapError(err)
+			}
+			continue
+		}
+
+		inserted, err := r.insertReturningEmails(ctx, tx, stmt+` on conflict (email) do nothing returning email`, args)
+		if err != nil {
+			return nil, r.dialect.mapError(err)
+		}
+
+		// of two rows of the batch with the same email, the first one is inserted
+		for i, user := range batch {
+			if inserted[user.Email] {
+				delete(inserted, user.Email)
+			} else {
+				duplicates[start+i] = true
+				skipped = true
+			}
+		}
+	}
+
+	if skipped && allOrNothing {
+		return duplicates, nil
+	}
+
+	return duplicates, tx.Commit()
+}
+
+func (r *sqlUserRepository) insertReturningEmails(ctx context.Context, tx *sql.Tx, stmt string, args []any) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inserted := map[string]bool{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		inserted[email] = true
+	}
+
+	return inserted, rows.Err()
+}
+
+// ResetPassword is the method we will use to change a user's password.
+func (r *sqlUserRepository) ResetPassword(id, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	stmt := `update users set password = $1 where id = $2 and deleted_at is null`
+	result, err := r.DB.ExecContext(ctx, stmt, string(hashedPassword), id)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetAllForPagination returns one page of the users matching the filter, in the given
+// sort order of UserKeyset, which always ends with id as a tiebreaker. A nil cursor
+// returns the first page, otherwise only the rows strictly after (or before, for a
+// backward cursor) the cursor position are returned, so rows sharing the same sort
+// values are neither skipped nor repeated between pages. The returned bool reports
+// whether more rows exist beyond the page in the direction of travel. Users are always
+// returned in the requested order.
+func (r *sqlUserRepository) GetAllForPagination(filter Filter, sort pagination.Sort, cursor *pagination.Cursor, limit int) ([]*User, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	backward := cursor != nil && cursor.Backward
+
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version, deleted_at
+	from users`
+
+	conditions, args := filter.where(1, r.dialect.like)
+
+	if cursor != nil {
+		condition, values := UserKeyset.Where(sort, cursor, len(args)+1)
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+
+	// one extra row is fetched to find out if there is another page after this one
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" order by %s limit $%d", UserKeyset.OrderBy(sort, backward), len(args))
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var users []*User
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.Active,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Version,
+			scanNullTime{&user.DeletedAt},
+		)
+		if err != nil {
+			log.Info().Msgf("Error scanning: %v", err)
+			return nil, false, err
+		}
+
+		// Don't want to return the user's password so setting the value to "-"
+		user.Password = "-"
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	users, hasMore := pagination.Trim(users, limit, backward)
+
+	return users, hasMore, nil
+}
+
+// GetPage returns the users matching the filter in the given sort order, skipping the
+// first offset of them. Unlike GetAllForPagination, deep pages get slower as the offset
+// grows, but any page can be reached directly.
+func (r *sqlUserRepository) GetPage(filter Filter, sort pagination.Sort, offset, limit int) ([]*User, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("negative offset %d", offset)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version, deleted_at
+	from users`
+
+	conditions, args := filter.where(1, r.dialect.like)
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" order by %s limit $%d offset $%d", UserKeyset.OrderBy(sort, false), len(args)-1, len(args))
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.Active,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Version,
+			scanNullTime{&user.DeletedAt},
+		)
+		if err != nil {
+			log.Info().Msgf("Error scanning: %v", err)
+			return nil, err
+		}
+
+		// Don't want to return the user's password so setting the value to "-"
+		user.Password = "-"
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Export streams the users matching the filter to each, straight from the rows of one
+// query: the driver reads them from the server as they are consumed, so memory stays
+// flat however many users there are. The query runs in a read only repeatable read
+// transaction, so the export is a consistent snapshot. The password is not selected.
+func (r *sqlUserRepository) Export(ctx context.Context, filter Filter, sort pagination.Sort, each func(*User) error) error {
+	tx, err := r.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `select id, email, first_name, last_name, user_active, created_at, updated_at, version, deleted_at
+	from users`
+
+	conditions, args := filter.where(1, r.dialect.like)
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	query += " order by " + UserKeyset.OrderBy(sort, false)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Active,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Version,
+			scanNullTime{&user.DeletedAt},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := each(&user); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Count returns the exact number of users matching the filter.
+func (r *sqlUserRepository) Count(filter Filter) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select count(*) from users`
+
+	conditions, args := filter.where(1, r.dialect.like)
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+
+	var count int64
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetChanges returns the users created, updated or deleted after the since position of
+// the change feed and before until, oldest first, or the whole directory when since is
+// nil. Every user shows up once, with its latest state. The returned bool reports
+// whether the feed has more changes after this batch.
+func (r *sqlUserRepository) GetChanges(since *pagination.Cursor, until time.Time, limit int) ([]*Change, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	sort := ChangeKeyset.Default
+
+	// a user is new to the client when it was created after the position it synced to
+	created := "true"
+	args := []any{formatTime(until)}
+	where := " where changed_at < $1"
+
+	if since != nil {
+		condition, values := ChangeKeyset.Where(sort, since, 2)
+		created = "(created_at, id) > ($2, $3)"
+		where += " and " + condition
+		args = append(args, values...)
+	}
+
+	args = append(args, limit+1)
+
+	query := fmt.Sprintf(`select id, email, first_name, last_name, user_active, created_at, updated_at, version, changed_at, deleted, %s
+	from (
+		select id, email, first_name, last_name, user_active, created_at, updated_at, version, updated_at as changed_at, false as deleted
+		from users
+		where deleted_at is null
+		union all
+		select id, '', '', '', false, deleted_at, deleted_at, 0, deleted_at, true
+		from user_tombstones
+	) changes%s order by %s limit $%d`, created, where, ChangeKeyset.OrderBy(sort, false), len(args))
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var changes []*Change
+
+	for rows.Next() {
+		var user User
+		var change Change
+		var deleted, isNew bool
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Active,
+			scanTime{&user.CreatedAt},
+			scanTime{&user.UpdatedAt},
+			&user.Version,
+			scanTime{&change.ChangedAt},
+			&deleted,
+			&isNew,
+		)
+		if err != nil {
+			log.Info().Msgf("Error scanning: %v", err)
+			return nil, false, err
+		}
+
+		change.ID = user.ID
+		switch {
+		case deleted:
+			change.Type = ChangeDeleted
+		case isNew:
+			change.Type = ChangeCreated
+			change.User = &user
+		default:
+			change.Type = ChangeUpdated
+			change.User = &user
+		}
+
+		// Don't want to return the user's password so setting the value to "-"
+		user.Password = "-"
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	changes, hasMore := pagination.Trim(changes, limit, false)
+
+	return changes, hasMore, nil
+}
+
+// EstimateCount returns the number of users matching the filter. Storages that can
+// estimate it more cheaply than they count it override this.
+func (r *sqlUserRepository) EstimateCount(filter Filter) (int64, error) {
+	return r.Count(filter)
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"myRestAPIWithPagination/pagination"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteUserRepository is the UserRepository storing users in a sqlite file, for single
+// node deployments that don't want to run postgres. It shares its queries with the
+// postgres storage; the differences are that text is sorted byte by byte, like only
+// ignores the case of ASCII letters, and EstimateCount is the exact count.
+type SQLiteUserRepository struct {
+	sqlUserRepository
+}
+
+var _ UserRepository = (*SQLiteUserRepository)(nil)
+
+var sqliteDialect = dialect{
+	like:     "like",
+	mapError: mapSQLiteError,
+	// no forUpdate: there is only one connection, see OpenSQLite, so a transaction has
+	// the whole database to itself
+}
+
+// OpenSQLite opens the sqlite database at path, creating the file if it doesn't exist
+// yet. The schema is created by the migrations of NewSQLiteMigrator.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only has one writer at a time, so a single connection saves the requests
+	// from waiting on each other's locks
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// NewSQLiteUserRepository returns a UserRepository using the given sqlite database, as
+// opened by OpenSQLite.
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{sqlUserRepository{DB: db, dialect: sqliteDialect}}
+}
+
+// sqliteExportBatch is the number of users Export reads per query.
+const sqliteExportBatch = 1000
+
+// Export calls each with the users matching the filter, reading them a keyset page at a
+// time. sqlite has a single connection, which one long query would keep away from every
+// other request for the whole export. Unlike the postgres export, users changed while the
+// export runs may show up in their new position.
+func (r *SQLiteUserRepository) Export(ctx context.Context, filter Filter, sort pagination.Sort, each func(*User) error) error {
+	var cursor *pagination.Cursor
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		users, hasMore, err := r.GetAllForPagination(filter, sort, cursor, sqliteExportBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			user.Password = ""
+			if err := each(user); err != nil {
+				return err
+			}
+		}
+
+		if !hasMore {
+			return nil
+		}
+
+		cursor, err = UserKeyset.ParseCursor(sort, UserKeyset.Keys(sort, users[len(users)-1]), false)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mapSQLiteError maps unique constraint violations to ErrDuplicate.
+func mapSQLiteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	}
+
+	return err
+}
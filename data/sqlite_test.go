@@ -0,0 +1,38 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openTestSQLite returns a sqlite database in a temporary file, closed when the test
+// ends, and the Migrator of its schema.
+func openTestSQLite(t *testing.T) (*sql.DB, *Migrator) {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewSQLiteMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, migrator
+}
+
+func TestSQLiteUserRepository(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		db, migrator := openTestSQLite(t)
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		return NewSQLiteUserRepository(db)
+	})
+}
@@ -0,0 +1,119 @@
+package pagination
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The kinds of total count a listing can include, picked with ?count=.
+const (
+	CountNone     = "none"
+	CountExact    = "exact"
+	CountEstimate = "estimate"
+)
+
+// ExactCountThreshold is the estimate under which counting the rows is cheap enough to
+// answer an estimate request with the exact number instead.
+const ExactCountThreshold = 10000
+
+// Count is a count of the rows matching a filter, and whether it is exact.
+type Count struct {
+	Count int64
+	Kind  string
+}
+
+// ParseCountKind validates the ?count= parameter, which defaults to none.
+func ParseCountKind(value string) (string, error) {
+	switch value {
+	case "", CountNone:
+		return CountNone, nil
+	case CountExact, CountEstimate:
+		return value, nil
+	default:
+		return "", fmt.Errorf("count must be one of exact, estimate or none, got %q", value)
+	}
+}
+
+// CountCache keeps total counts for a short while, so that paging through a listing
+// doesn't run the same count for every page.
+type CountCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]countCacheEntry
+}
+
+type countCacheEntry struct {
+	count   Count
+	expires time.Time
+}
+
+// NewCountCache returns a cache keeping counts for ttl.
+func NewCountCache(ttl time.Duration) *CountCache {
+	return &CountCache{
+		ttl:     ttl,
+		entries: map[string]countCacheEntry{},
+	}
+}
+
+// Count returns the number of rows of the requested kind for the given cache key, which
+// should name the table and canonical filter. It is computed with exact or estimate on
+// a cache miss. An estimate small enough to be counted cheaply is replaced by the exact
+// count, so the kind of the result may differ from the one asked for.
+func (c *CountCache) Count(key, kind string, exact, estimate func() (int64, error)) (Count, error) {
+	key = kind + "|" + key
+	if count, ok := c.get(key); ok {
+		return count, nil
+	}
+
+	var count Count
+	var err error
+
+	if kind == CountEstimate {
+		count = Count{Kind: CountEstimate}
+		count.Count, err = estimate()
+		if err != nil {
+			return Count{}, err
+		}
+	}
+
+	if kind == CountExact || count.Count < ExactCountThreshold {
+		count = Count{Kind: CountExact}
+		count.Count, err = exact()
+		if err != nil {
+			return Count{}, err
+		}
+	}
+
+	c.set(key, count)
+
+	return count, nil
+}
+
+func (c *CountCache) get(key string) (Count, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return Count{}, false
+	}
+
+	return entry.count, true
+}
+
+func (c *CountCache) set(key string, count Count) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// drop whatever has expired, so filters that are never asked for again don't pile up
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = countCacheEntry{count: count, expires: now.Add(c.ttl)}
+}
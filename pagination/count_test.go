@@ -0,0 +1,57 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCountKind(t *testing.T) {
+	for value, want := range map[string]string{"": CountNone, "none": CountNone, "exact": CountExact, "estimate": CountEstimate} {
+		if got, err := ParseCountKind(value); err != nil || got != want {
+			t.Errorf("ParseCountKind(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseCountKind("all"); err == nil {
+		t.Error("ParseCountKind(\"all\") succeeded")
+	}
+}
+
+func TestCountCache(t *testing.T) {
+	var exactCalls, estimateCalls int
+	counter := func(exactCount, estimatedCount int64) (func() (int64, error), func() (int64, error)) {
+		return func() (int64, error) { exactCalls++; return exactCount, nil },
+			func() (int64, error) { estimateCalls++; return estimatedCount, nil }
+	}
+
+	cache := NewCountCache(time.Minute)
+
+	exact, estimate := counter(12, 99999)
+	for i := 0; i < 2; i++ {
+		if count, _ := cache.Count("users|", CountExact, exact, estimate); count != (Count{Count: 12, Kind: CountExact}) {
+			t.Errorf("exact count = %+v", count)
+		}
+	}
+	if exactCalls != 1 || estimateCalls != 0 {
+		t.Errorf("two exact counts ran %d exact and %d estimated counts, want 1 and 0", exactCalls, estimateCalls)
+	}
+
+	// a large estimate is kept, and cached apart from the exact count of the same key
+	if count, _ := cache.Count("users|", CountEstimate, exact, estimate); count != (Count{Count: 99999, Kind: CountEstimate}) {
+		t.Errorf("large estimate = %+v", count)
+	}
+
+	// a small one is replaced with the exact count
+	exact, estimate = counter(12, ExactCountThreshold-1)
+	if count, _ := cache.Count("users|user_active=true", CountEstimate, exact, estimate); count != (Count{Count: 12, Kind: CountExact}) {
+		t.Errorf("small estimate = %+v", count)
+	}
+
+	expired := NewCountCache(0)
+	exactCalls = 0
+	for i := 0; i < 2; i++ {
+		expired.Count("users|", CountExact, exact, estimate)
+	}
+	if exactCalls != 2 {
+		t.Errorf("a cache without a TTL counted %d times for 2 requests", exactCalls)
+	}
+}
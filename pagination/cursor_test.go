@@ -0,0 +1,61 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	codec := Codec{Key: []byte("test-cursor-key"), TTL: time.Minute}
+	query := Token{Sort: "created_at", FilterHash: HashFilter("user_active=true"), Limit: 20}
+
+	token := query
+	token.Keys = []string{"2024-05-01 12:00:00", "1"}
+	encoded := codec.Encode(token)
+
+	got, err := codec.Read(encoded, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Sort != token.Sort || got.FilterHash != token.FilterHash || got.Limit != token.Limit || len(got.Keys) != 2 || got.Keys[1] != "1" {
+		t.Errorf("Read() = %+v, want %+v", got, token)
+	}
+
+	otherLimit := query
+	otherLimit.Limit = 10
+	otherKey := Codec{Key: []byte("other-key")}
+	// a codec without a TTL keeps the expiry of the token
+	expired := token
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		codec   Codec
+		encoded string
+		query   Token
+		want    error
+	}{
+		{"not base64", codec, "not a cursor!", query, ErrCursorMalformed},
+		{"too short", codec, "AQ", query, ErrCursorMalformed},
+		{"tampered", codec, encoded[:len(encoded)-2] + "AA", query, ErrCursorSignature},
+		{"other key", otherKey, encoded, query, ErrCursorSignature},
+		{"other query", codec, encoded, otherLimit, ErrCursorMismatch},
+		{"expired", codec, Codec{Key: codec.Key}.Encode(expired), query, ErrCursorExpired},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.codec.Read(tt.encoded, tt.query); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Read() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestHashFilter(t *testing.T) {
+	if HashFilter("user_active=true") != HashFilter("user_active=true") {
+		t.Error("HashFilter() differs for the same key")
+	}
+	if HashFilter("user_active=true") == HashFilter("user_active=false") {
+		t.Error("HashFilter() is the same for different keys")
+	}
+}
@@ -0,0 +1,330 @@
+package pagination
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind tells how the values of a sortable column are written into and read back from a
+// cursor.
+type Kind int
+
+const (
+	String Kind = iota
+	Time
+	Bool
+	Int
+)
+
+// SortField is one column of an ordering.
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Sort is an ordering of rows, as parsed by Keyset.ParseSort.
+type Sort []SortField
+
+// String returns the canonical form of the sort, which Keyset.ParseSort reads back.
+func (s Sort) String() string {
+	parts := make([]string, len(s))
+	for i, field := range s {
+		parts[i] = field.Column
+		if field.Desc {
+			parts[i] = "-" + field.Column
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Cursor is a position in a Sort ordering, given as the values of its sort columns and
+// tiebreaker, as returned by Keyset.ParseCursor. When Backward is set the page ends just
+// before the position, otherwise it starts just after it.
+type Cursor struct {
+	Values   []any
+	Backward bool
+}
+
+// Keyset describes how the rows of one table are ordered for keyset pagination. Each
+// model declares one, and gets sort parsing, cursor keys and the keyset SQL from it.
+type Keyset[T any] struct {
+	// Columns is the allowlist of columns rows can be sorted by.
+	Columns map[string]Kind
+	// Tiebreaker is a unique column, always appended as the last sort column so that
+	// every row has a unique position a cursor can point to.
+	Tiebreaker     string
+	TiebreakerKind Kind
+	// Default is the sort used when none is asked for.
+	Default Sort
+	// Value returns the value of a sort column or the tiebreaker for a row, as a
+	// string, time.Time, bool or int64 depending on the column's Kind.
+	Value func(row T, column string) any
+	// TimeLayout, when set, is the layout time values are formatted with before they
+	// are bound to a query by Where, e.g. for "timestamp without time zone" columns.
+	TimeLayout string
+}
+
+// ParseSort parses a comma separated list of columns such as "last_name,-created_at",
+// where a leading "-" means descending. An empty spec returns the default sort.
+func (k Keyset[T]) ParseSort(spec string) (Sort, error) {
+	if strings.TrimSpace(spec) == "" {
+		return k.Default, nil
+	}
+
+	var sort Sort
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+
+		field := SortField{Column: part}
+		if strings.HasPrefix(part, "-") {
+			field = SortField{Column: part[1:], Desc: true}
+		} else if strings.HasPrefix(part, "+") {
+			field.Column = part[1:]
+		}
+
+		if _, ok := k.Columns[field.Column]; !ok {
+			return nil, fmt.Errorf("can't sort by %q", field.Column)
+		}
+		if seen[field.Column] {
+			return nil, fmt.Errorf("%q is sorted by more than once", field.Column)
+		}
+		seen[field.Column] = true
+
+		sort = append(sort, field)
+	}
+
+	return sort, nil
+}
+
+// fields returns the sort with the tiebreaker appended. The tiebreaker follows the
+// direction of the last column, so a single column sort stays a single row comparison.
+func (k Keyset[T]) fields(sort Sort) Sort {
+	tiebreaker := SortField{Column: k.Tiebreaker}
+	if len(sort) > 0 {
+		tiebreaker.Desc = sort[len(sort)-1].Desc
+	}
+
+	return append(sort[:len(sort):len(sort)], tiebreaker)
+}
+
+func (k Keyset[T]) kind(column string) Kind {
+	if column == k.Tiebreaker {
+		return k.TiebreakerKind
+	}
+
+	return k.Columns[column]
+}
+
+// Keys returns the values of every sort column of the row, followed by its tiebreaker,
+// in the text form stored in cursors.
+func (k Keyset[T]) Keys(sort Sort, row T) []string {
+	fields := k.fields(sort)
+	keys := make([]string, len(fields))
+
+	for i, field := range fields {
+		switch value := k.Value(row, field.Column).(type) {
+		case time.Time:
+			keys[i] = value.Format(time.RFC3339Nano)
+		case bool:
+			keys[i] = strconv.FormatBool(value)
+		case int64:
+			keys[i] = strconv.FormatInt(value, 10)
+		default:
+			keys[i] = fmt.Sprint(value)
+		}
+	}
+
+	return keys
+}
+
+// ParseCursor reads back the keys produced by Keys into a position in the sort.
+func (k Keyset[T]) ParseCursor(sort Sort, keys []string, backward bool) (*Cursor, error) {
+	fields := k.fields(sort)
+	if len(keys) != len(fields) {
+		return nil, fmt.Errorf("cursor has %d keys, the sort needs %d", len(keys), len(fields))
+	}
+
+	values := make([]any, len(keys))
+
+	for i, field := range fields {
+		switch k.kind(field.Column) {
+		case Time:
+			t, err := time.Parse(time.RFC3339Nano, keys[i])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = t
+		case Bool:
+			b, err := strconv.ParseBool(keys[i])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = b
+		case Int:
+			n, err := strconv.ParseInt(keys[i], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = n
+		default:
+			values[i] = keys[i]
+		}
+	}
+
+	return &Cursor{Values: values, Backward: backward}, nil
+}
+
+// OrderBy returns the order by clause of the sort. Going backward every direction is
+// flipped, and the rows are put back in order by Trim once they are read.
+func (k Keyset[T]) OrderBy(sort Sort, backward bool) string {
+	fields := k.fields(sort)
+	parts := make([]string, len(fields))
+
+	for i, field := range fields {
+		parts[i] = field.Column + " asc"
+		if field.Desc != backward {
+			parts[i] = field.Column + " desc"
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Where returns the condition selecting the rows after the cursor (before it for a
+// backward cursor), with placeholders numbered from $firstArg, and its arguments. When
+// every column goes the same way it is a single row comparison, which the database can
+// answer from a matching index; mixed directions need the expanded form
+// (a > $1) or (a = $1 and b < $2) or ...
+func (k Keyset[T]) Where(sort Sort, cursor *Cursor, firstArg int) (string, []any) {
+	fields := k.fields(sort)
+
+	sameDirection := true
+	for _, field := range fields {
+		if field.Desc != fields[0].Desc {
+			sameDirection = false
+		}
+	}
+
+	operator := func(field SortField) string {
+		if field.Desc != cursor.Backward {
+			return "<"
+		}
+		return ">"
+	}
+
+	if sameDirection {
+		columns := make([]string, len(fields))
+		placeholders := make([]string, len(fields))
+		for i, field := range fields {
+			columns[i] = field.Column
+			placeholders[i] = fmt.Sprintf("$%d", firstArg+i)
+		}
+
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator(fields[0]), strings.Join(placeholders, ", ")), k.args(cursor)
+	}
+
+	var ors []string
+	for i, field := range fields {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = $%d", fields[j].Column, firstArg+j))
+		}
+		ands = append(ands, fmt.Sprintf("%s %s $%d", field.Column, operator(field), firstArg+i))
+
+		ors = append(ors, "("+strings.Join(ands, " and ")+")")
+	}
+
+	return "(" + strings.Join(ors, " or ") + ")", k.args(cursor)
+}
+
+// args returns the cursor values as query arguments.
+func (k Keyset[T]) args(cursor *Cursor) []any {
+	args := make([]any, len(cursor.Values))
+	for i, value := range cursor.Values {
+		args[i] = value
+		if t, ok := value.(time.Time); ok && k.TimeLayout != "" {
+			args[i] = t.UTC().Format(k.TimeLayout)
+		}
+	}
+
+	return args
+}
+
+// Compare orders two rows the way OrderBy does, returning a negative number when a
+// comes first, a positive one when b does, and zero for the same position. It is for
+// storages that sort rows themselves instead of in SQL.
+func (k Keyset[T]) Compare(sort Sort, a, b T) int {
+	for _, field := range k.fields(sort) {
+		c := compareValues(k.Value(a, field.Column), k.Value(b, field.Column))
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// After reports whether the row is past the cursor in its direction of travel, which
+// is what Where selects: after it for a forward cursor, before it for a backward one.
+func (k Keyset[T]) After(sort Sort, row T, cursor *Cursor) bool {
+	for i, field := range k.fields(sort) {
+		c := compareValues(k.Value(row, field.Column), cursor.Values[i])
+		if field.Desc != cursor.Backward {
+			c = -c
+		}
+		if c != 0 {
+			return c > 0
+		}
+	}
+
+	return false
+}
+
+// compareValues compares two values of the same column kind.
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bool:
+		b := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		default:
+			return 1
+		}
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+// Trim takes the rows of a keyset query that fetched limit+1 rows, and returns the page
+// along with whether there are more rows beyond it in the direction of travel. Rows read
+// backward are put back in the requested order.
+func Trim[T any](rows []T, limit int, backward bool) ([]T, bool) {
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	return rows, hasMore
+}
@@ -0,0 +1,208 @@
+package pagination
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	id     string
+	name   string
+	n      int64
+	active bool
+	at     time.Time
+}
+
+var testKeyset = Keyset[testRow]{
+	Columns: map[string]Kind{
+		"name":   String,
+		"n":      Int,
+		"active": Bool,
+		"at":     Time,
+	},
+	Tiebreaker: "id",
+	Default:    Sort{{Column: "at"}},
+	Value: func(row testRow, column string) any {
+		switch column {
+		case "name":
+			return row.name
+		case "n":
+			return row.n
+		case "active":
+			return row.active
+		case "at":
+			return row.at
+		default:
+			return row.id
+		}
+	},
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Sort
+		wantErr bool
+	}{
+		{spec: "", want: Sort{{Column: "at"}}},
+		{spec: "name", want: Sort{{Column: "name"}}},
+		{spec: "-name, +n", want: Sort{{Column: "name", Desc: true}, {Column: "n"}}},
+		{spec: "password", wantErr: true},
+		{spec: "name,-name", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := testKeyset.ParseSort(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSort(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSort(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestKeysetWhere(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		sort     Sort
+		cursor   *Cursor
+		firstArg int
+		want     string
+	}{
+		{
+			name:     "ascending",
+			sort:     Sort{{Column: "name"}},
+			cursor:   &Cursor{Values: []any{"b", "2"}},
+			firstArg: 1,
+			want:     "(name, id) > ($1, $2)",
+		},
+		{
+			name:     "descending",
+			sort:     Sort{{Column: "name", Desc: true}},
+			cursor:   &Cursor{Values: []any{"b", "2"}},
+			firstArg: 1,
+			want:     "(name, id) < ($1, $2)",
+		},
+		{
+			name:     "descending backward",
+			sort:     Sort{{Column: "name", Desc: true}},
+			cursor:   &Cursor{Values: []any{"b", "2"}, Backward: true},
+			firstArg: 1,
+			want:     "(name, id) > ($1, $2)",
+		},
+		{
+			name:     "two columns after other arguments",
+			sort:     Sort{{Column: "at"}, {Column: "n"}},
+			cursor:   &Cursor{Values: []any{at, int64(3), "2"}},
+			firstArg: 4,
+			want:     "(at, n, id) > ($4, $5, $6)",
+		},
+		{
+			name:     "mixed directions",
+			sort:     Sort{{Column: "name"}, {Column: "n", Desc: true}},
+			cursor:   &Cursor{Values: []any{"b", int64(3), "2"}},
+			firstArg: 1,
+			want:     "((name > $1) or (name = $1 and n < $2) or (name = $1 and n = $2 and id < $3))",
+		},
+		{
+			name:     "mixed directions backward",
+			sort:     Sort{{Column: "name", Desc: true}, {Column: "n"}},
+			cursor:   &Cursor{Values: []any{"b", int64(3), "2"}, Backward: true},
+			firstArg: 2,
+			want:     "((name > $2) or (name = $2 and n < $3) or (name = $2 and n = $3 and id < $4))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := testKeyset.Where(tt.sort, tt.cursor, tt.firstArg)
+			if got != tt.want {
+				t.Errorf("Where() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.cursor.Values) {
+				t.Errorf("Where() args = %v, want %v", args, tt.cursor.Values)
+			}
+		})
+	}
+}
+
+func TestKeysetWhereTimeLayout(t *testing.T) {
+	keyset := testKeyset
+	keyset.TimeLayout = "2006-01-02 15:04:05.999999"
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.FixedZone("CEST", 2*60*60))
+	_, args := keyset.Where(Sort{{Column: "at"}}, &Cursor{Values: []any{at, "2"}}, 1)
+
+	want := []any{"2024-05-01 10:00:00.5", "2"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Where() args = %v, want %v", args, want)
+	}
+}
+
+// TestKeysetAfter checks After against the order of Compare: going forward, the rows
+// after a cursor are the ones sorted after its row, and going backward the ones before.
+func TestKeysetAfter(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var rows []testRow
+	for i, name := range []string{"b", "a", "c", "a", "b", "c", "a", "b"} {
+		rows = append(rows, testRow{
+			id:     string(rune('a' + i)),
+			name:   name,
+			n:      int64(i % 3),
+			active: i%2 == 0,
+			at:     at.Add(time.Duration(i%4) * time.Hour),
+		})
+	}
+
+	sorts := []string{"name", "-name", "n,-name", "-at,name", "active,-n,at", "-active,-n,-at"}
+
+	for _, spec := range sorts {
+		sort, err := testKeyset.ParseSort(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sorted := slices.Clone(rows)
+		slices.SortFunc(sorted, func(a, b testRow) int {
+			return testKeyset.Compare(sort, a, b)
+		})
+
+		for i, current := range sorted {
+			for _, backward := range []bool{false, true} {
+				cursor, err := testKeyset.ParseCursor(sort, testKeyset.Keys(sort, current), backward)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for j, row := range sorted {
+					want := j > i
+					if backward {
+						want = j < i
+					}
+					if got := testKeyset.After(sort, row, cursor); got != want {
+						t.Errorf("sort %q, backward %v: After(row %d, cursor at row %d) = %v, want %v", spec, backward, j, i, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTrim(t *testing.T) {
+	rows, hasMore := Trim([]int{3, 2, 1}, 2, true)
+	if !reflect.DeepEqual(rows, []int{2, 3}) || !hasMore {
+		t.Errorf("Trim() = %v, %v, want [2 3], true", rows, hasMore)
+	}
+
+	rows, hasMore = Trim([]int{1, 2}, 2, false)
+	if !reflect.DeepEqual(rows, []int{1, 2}) || hasMore {
+		t.Errorf("Trim() = %v, %v, want [1 2], false", rows, hasMore)
+	}
+}
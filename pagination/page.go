@@ -0,0 +1,142 @@
+// Package pagination holds the paging machinery shared by every listing of the API:
+// the Page envelope, signed cursors, keyset SQL, total counts and the parsing of paging
+// query parameters. A model only has to declare a Keyset and a filter key to get the
+// same paging behaviour as the others.
+package pagination
+
+import "net/url"
+
+// Page is the envelope every paginated listing responds with. Cursor pages fill the
+// cursor fields, numbered pages the page fields.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	TotalItem  int    `json:"total_item"`
+	TotalCount *int64 `json:"total_count,omitempty"`
+	CountType  string `json:"count_type,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page,omitempty"`
+	TotalPages int    `json:"total_pages,omitempty"`
+	// AsOf is the moment a snapshot traversal is pinned to.
+	AsOf string `json:"as_of,omitempty"`
+
+	links map[string]int
+}
+
+// CursorPage builds the envelope of a keyset page. query holds the sort, filter hash,
+// limit and snapshot time the page was fetched with, and from is the cursor it was fetched from, nil for
+// the first page. keys returns the cursor keys of a row, see Keyset.Keys.
+func CursorPage[T any](codec Codec, rows []T, hasMore bool, query Token, from *Token, keys func(T) []string) Page[T] {
+	page := Page[T]{
+		Items:     rows,
+		TotalItem: len(rows),
+		HasMore:   hasMore,
+		AsOf:      query.AsOf,
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	newCursor := func(keys []string, backward bool) string {
+		token := query
+		token.Keys = keys
+		token.Backward = backward
+		return codec.Encode(token)
+	}
+
+	// has_more only tells about the direction we travelled in. Coming from a cursor
+	// means there is always something on the other side of it.
+	backward := from != nil && from.Backward
+	hasNext := backward || hasMore
+	hasPrev := (backward && hasMore) || (!backward && from != nil)
+
+	if len(rows) > 0 {
+		if hasNext {
+			page.NextCursor = newCursor(keys(rows[len(rows)-1]), false)
+		}
+		if hasPrev {
+			page.PrevCursor = newCursor(keys(rows[0]), true)
+		}
+	} else if from != nil {
+		// an empty page past either end, so the only way is back through the same position
+		if from.Backward {
+			page.NextCursor = newCursor(from.Keys, false)
+		} else {
+			page.PrevCursor = newCursor(from.Keys, true)
+		}
+	}
+
+	return page
+}
+
+// NumberedPage builds the envelope of an offset page, given the total number of rows
+// the listing has.
+func NumberedPage[T any](rows []T, page, perPage int, total int64) Page[T] {
+	totalPages := int((total + int64(perPage) - 1) / int64(perPage))
+	last := max(totalPages, 1)
+
+	p := Page[T]{
+		Items:      rows,
+		TotalItem:  len(rows),
+		HasMore:    page < totalPages,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+		links:      map[string]int{"first": 1, "last": last},
+	}
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+	p.SetCount(Count{Count: total, Kind: CountExact})
+
+	if page > 1 {
+		p.links["prev"] = min(page-1, last)
+	}
+	if page < totalPages {
+		p.links["next"] = page + 1
+	}
+
+	return p
+}
+
+// SetCount adds a total count to the page.
+func (p *Page[T]) SetCount(count Count) {
+	p.TotalCount = &count.Count
+	p.CountType = count.Kind
+}
+
+// Link returns the Link header of a numbered page, relative to the request URL u. It is
+// empty for cursor pages.
+func (p *Page[T]) Link(u *url.URL) string {
+	if p.links == nil {
+		return ""
+	}
+
+	return LinkHeader(u, p.links)
+}
+
+// MapItems returns the page with every item converted by f, e.g. from a model to the
+// type the API responds with.
+func MapItems[T, U any](page Page[T], f func(T) U) Page[U] {
+	items := make([]U, len(page.Items))
+	for i, item := range page.Items {
+		items[i] = f(item)
+	}
+
+	return Page[U]{
+		Items:      items,
+		TotalItem:  page.TotalItem,
+		TotalCount: page.TotalCount,
+		CountType:  page.CountType,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		HasMore:    page.HasMore,
+		Page:       page.Page,
+		PerPage:    page.PerPage,
+		TotalPages: page.TotalPages,
+		AsOf:       page.AsOf,
+		links:      page.links,
+	}
+}
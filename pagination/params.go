@@ -0,0 +1,126 @@
+package pagination
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Params are the paging parameters of a listing request, read by ParseParams.
+type Params struct {
+	// Limit is the page size of cursor pagination, ?limit=.
+	Limit int
+	// Cursor is the opaque cursor of the page to fetch, ?cursor=; empty for the first page.
+	Cursor string
+	// Sort is the requested ordering, ?sort=, to be parsed by a Keyset.
+	Sort string
+	// Count is the kind of total count to include, ?count=.
+	Count string
+	// Snapshot asks for a snapshot traversal, ?snapshot=true: every page of it lists the
+	// rows there were when the first page was read, each at most once, with their
+	// current values. The sort must be by columns that never change.
+	Snapshot bool
+	// Page and PerPage are the page number and size of offset pagination, ?page= and
+	// ?per_page=.
+	Page    int
+	PerPage int
+}
+
+// ParseParams reads the paging parameters from a query string. Page sizes default to
+// defaultLimit and are capped to maxLimit.
+func ParseParams(query url.Values, defaultLimit, maxLimit int) (Params, error) {
+	params := Params{
+		Limit:   min(defaultLimit, maxLimit),
+		PerPage: min(defaultLimit, maxLimit),
+		Cursor:  query.Get("cursor"),
+		Sort:    query.Get("sort"),
+	}
+
+	var err error
+
+	if value := query.Get("limit"); value != "" {
+		params.Limit, err = ParseLimit(value, maxLimit)
+		if err != nil {
+			return params, err
+		}
+	}
+
+	if value := query.Get("per_page"); value != "" {
+		params.PerPage, err = ParseLimit(value, maxLimit)
+		if err != nil {
+			return params, fmt.Errorf("per_page: %w", err)
+		}
+	}
+
+	if value := query.Get("snapshot"); value != "" {
+		params.Snapshot, err = strconv.ParseBool(value)
+		if err != nil {
+			return params, fmt.Errorf("snapshot must be true or false, got %q", value)
+		}
+	}
+
+	params.Page, err = ParsePage(query.Get("page"), params.PerPage)
+	if err != nil {
+		return params, err
+	}
+
+	params.Count, err = ParseCountKind(query.Get("count"))
+	if err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
+
+// ParseLimit validates a page size. It must be a positive integer, and anything above
+// maxLimit is capped to maxLimit.
+func ParseLimit(value string, maxLimit int) (int, error) {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("limit must be a positive integer, got %q", value)
+	}
+
+	return min(limit, maxLimit), nil
+}
+
+// ParsePage validates a 1-based page number. An empty value means the first page. Pages
+// of perPage rows must start at an offset that fits in an int, which bounds the number.
+func ParsePage(value string, perPage int) (int, error) {
+	if value == "" {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(value)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("page must be a positive integer, got %q", value)
+	}
+	if last := math.MaxInt/perPage + 1; page > last {
+		return 0, fmt.Errorf("page can't be over %d with %d per page, got %q", last, perPage, value)
+	}
+
+	return page, nil
+}
+
+// LinkHeader builds an RFC 8288 Link header value pointing at other pages of the request
+// URL u, keeping every other query parameter as it is. pages maps relation types such as
+// "next" to page numbers.
+func LinkHeader(u *url.URL, pages map[string]int) string {
+	var links []string
+
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		page, ok := pages[rel]
+		if !ok {
+			continue
+		}
+
+		query := u.Query()
+		query.Set("page", strconv.Itoa(page))
+		target := url.URL{Path: u.Path, RawQuery: query.Encode()}
+
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,52 @@
+package pagination
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	params, err := ParseParams(url.Values{}, 20, 100)
+	if err != nil || params.Limit != 20 || params.PerPage != 20 || params.Page != 1 || params.Count != CountNone {
+		t.Errorf("ParseParams() of no parameters = %+v, %v", params, err)
+	}
+
+	params, err = ParseParams(url.Values{"limit": {"500"}, "per_page": {"7"}, "page": {"3"}, "snapshot": {"true"}}, 20, 100)
+	if err != nil || params.Limit != 100 || params.PerPage != 7 || params.Page != 3 || !params.Snapshot {
+		t.Errorf("ParseParams() = %+v, %v", params, err)
+	}
+
+	for _, query := range []url.Values{
+		{"limit": {"0"}},
+		{"per_page": {"ten"}},
+		{"page": {"-1"}},
+		{"snapshot": {"maybe"}},
+		{"count": {"all"}},
+	} {
+		if _, err := ParseParams(query, 20, 100); err == nil {
+			t.Errorf("ParseParams(%v) succeeded", query)
+		}
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	// the offset of the last page allowed is the largest int
+	last := math.MaxInt/20 + 1
+	if page, err := ParsePage(strconv.Itoa(last), 20); err != nil || (page-1)*20 < 0 {
+		t.Errorf("ParsePage(%d) = %d, %v", last, page, err)
+	}
+	if _, err := ParsePage(strconv.Itoa(last+1), 20); err == nil {
+		t.Errorf("ParsePage(%d) succeeded", last+1)
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	u, _ := url.Parse("/v1/employees?per_page=2&page=2&sort=email")
+	got := LinkHeader(u, map[string]int{"last": 3, "first": 1})
+	want := `</v1/employees?page=1&per_page=2&sort=email>; rel="first", </v1/employees?page=3&per_page=2&sort=email>; rel="last"`
+	if got != want {
+		t.Errorf("LinkHeader() = %s, want %s", got, want)
+	}
+}
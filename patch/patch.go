@@ -0,0 +1,471 @@
+// Package patch applies the two JSON patch formats to JSON documents: JSON Merge Patch
+// (RFC 7396), a partial document whose null members remove fields, and JSON Patch
+// (RFC 6902), a list of add, remove, replace, move, copy and test operations addressed
+// with JSON Pointers (RFC 6901).
+//
+// Documents are patched as JSON, so the package knows nothing of the resources behind
+// them: decoding and validating the result is up to the caller.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The media types of the patch formats.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	// ErrMalformed is returned for a patch document that isn't one: not JSON, or
+	// operations missing their members.
+	ErrMalformed = errors.New("malformed patch document")
+	// ErrTestFailed is returned when a test operation doesn't hold.
+	ErrTestFailed = errors.New("test failed")
+	// ErrPath is returned when an operation addresses a location the document doesn't
+	// have.
+	ErrPath = errors.New("no such path")
+)
+
+// OperationError is the error of one operation of a JSON Patch, wrapping ErrTestFailed
+// or ErrPath.
+type OperationError struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// Merge applies the merge patch to the document.
+func Merge(doc, patch []byte) ([]byte, error) {
+	var p any
+	if err := decode(patch, &p); err != nil {
+		return nil, err
+	}
+
+	var target any
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+// merge is the MergePatch function of RFC 7396.
+func merge(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = merge(object[name], value)
+		}
+	}
+
+	return object
+}
+
+// Operation is one operation of a JSON Patch.
+type Operation struct {
+	Op    string
+	Path  []string
+	From  []string
+	Value any
+
+	path string
+}
+
+// Patch is a parsed JSON Patch.
+type Patch []Operation
+
+// Parse reads a JSON Patch, checking every operation has the members its kind needs.
+func Parse(data []byte) (Patch, error) {
+	var raw []map[string]json.RawMessage
+	if err := decode(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: a JSON Patch must be an array of operations", ErrMalformed)
+	}
+
+	patch := make(Patch, len(raw))
+	for i, members := range raw {
+		op := &patch[i]
+
+		var err error
+		if op.Op, err = stringMember(members, "op"); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrMalformed, i, err)
+		}
+		if op.path, err = stringMember(members, "path"); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrMalformed, i, err)
+		}
+		if op.Path, err = parsePointer(op.path); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrMalformed, i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			value, ok := members["value"]
+			if !ok {
+				return nil, fmt.Errorf("%w: operation %d: %s needs a value", ErrMalformed, i, op.Op)
+			}
+			if err := decode(value, &op.Value); err != nil {
+				return nil, err
+			}
+		case "move", "copy":
+			from, err := stringMember(members, "from")
+			if err == nil {
+				op.From, err = parsePointer(from)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrMalformed, i, err)
+			}
+			if op.Op == "move" && len(op.From) < len(op.Path) && isPrefix(op.From, op.Path) {
+				return nil, fmt.Errorf("%w: operation %d: can't move a value into itself", ErrMalformed, i)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: operation %d: unknown op %q", ErrMalformed, i, op.Op)
+		}
+	}
+
+	return patch, nil
+}
+
+// Apply applies the operations to the document in order, and returns the result if they
+// all succeed.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	var value any
+	if err := decode(doc, &value); err != nil {
+		return nil, err
+	}
+
+	for i, op := range p {
+		var err error
+		value, err = op.apply(value)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Path: op.path, Err: err}
+		}
+	}
+
+	return json.Marshal(value)
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.Path, op.Value)
+	case "remove":
+		doc, _, err := remove(doc, op.Path)
+		return doc, err
+	case "replace":
+		if len(op.Path) == 0 {
+			return op.Value, nil
+		}
+		doc, _, err := remove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, op.Value)
+	case "move":
+		doc, value, err := remove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "copy":
+		value, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, deepCopy(value))
+	case "test":
+		value, err := get(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	panic("patch: unknown op " + op.Op)
+}
+
+// get returns the value at path.
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, ErrPath
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, ErrPath
+		}
+	}
+
+	return doc, nil
+}
+
+// add adds value at path and returns the document, which is value itself for the root.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			i, err := index(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		default:
+			return nil, ErrPath
+		}
+	})
+}
+
+// remove removes the value at path, and returns the document and that value.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: the whole document can't be removed", ErrPath)
+	}
+
+	var removed any
+	doc, err := update(doc, path, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, ErrPath
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []any:
+			i, err := index(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[i]
+			return append(container[:i], container[i+1:]...), nil
+		default:
+			return nil, ErrPath
+		}
+	})
+
+	return doc, removed, err
+}
+
+// update walks down to the parent of path, replaces it with what change makes of it
+// given the last token of path, and returns the document.
+func update(doc any, path []string, change func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	switch container := doc.(type) {
+	case map[string]any:
+		child, ok := container[path[0]]
+		if !ok {
+			return nil, ErrPath
+		}
+		child, err := update(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		container[path[0]] = child
+		return container, nil
+	case []any:
+		i, err := index(path[0], len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(container[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = child
+		return container, nil
+	default:
+		return nil, ErrPath
+	}
+}
+
+// index parses an array index of a pointer, which can't be more than last.
+func index(token string, last int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrPath, token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrPath, token)
+	}
+	if i > last {
+		return 0, fmt.Errorf("%w: index %d is out of bounds", ErrPath, i)
+	}
+
+	return i, nil
+}
+
+// unescape undoes the escaping of / and ~ in pointer tokens, in the order RFC 6901 says.
+var unescape = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("pointer %q doesn't start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equal compares JSON values the way test does: numbers by value, objects regardless of
+// the order of their members.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	default:
+		return a == b
+	}
+}
+
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		object := make(map[string]any, len(value))
+		for name, member := range value {
+			object[name] = deepCopy(member)
+		}
+		return object
+	case []any:
+		array := make([]any, len(value))
+		for i, element := range value {
+			array[i] = deepCopy(element)
+		}
+		return array
+	default:
+		return value
+	}
+}
+
+// stringMember returns a string member of an operation.
+func stringMember(members map[string]json.RawMessage, name string) (string, error) {
+	raw, ok := members[name]
+	if !ok {
+		return "", fmt.Errorf("missing %q", name)
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("%q must be a string", name)
+	}
+
+	return value, nil
+}
+
+// decode decodes a single JSON value, keeping numbers as they are written.
+func decode(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("%w: more than one JSON value", ErrMalformed)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual reports whether two documents are the same JSON value.
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+
+	return reflect.DeepEqual(x, y)
+}
+
+// The cases are the examples of RFC 7396, appendix A.
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("Merge(%s, %s) error: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !jsonEqual(t, got, []byte(tt.want)) {
+			t.Errorf("Merge(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestMergeMalformed(t *testing.T) {
+	if _, err := Merge([]byte(`{}`), []byte(`{`)); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Merge() error = %v, want ErrMalformed", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		ok    bool
+	}{
+		{"every op", `[
+			{"op":"add","path":"/a","value":1},
+			{"op":"remove","path":"/a"},
+			{"op":"replace","path":"/a","value":null},
+			{"op":"move","from":"/a","path":"/b"},
+			{"op":"copy","from":"/a","path":"/b"},
+			{"op":"test","path":"/a","value":[1]}
+		]`, true},
+		{"empty", `[]`, true},
+		{"not an array", `{"op":"remove","path":"/a"}`, false},
+		{"not JSON", `[`, false},
+		{"missing op", `[{"path":"/a"}]`, false},
+		{"unknown op", `[{"op":"delete","path":"/a"}]`, false},
+		{"missing path", `[{"op":"remove"}]`, false},
+		{"path not a string", `[{"op":"remove","path":1}]`, false},
+		{"path without slash", `[{"op":"remove","path":"a"}]`, false},
+		{"missing value", `[{"op":"add","path":"/a"}]`, false},
+		{"missing from", `[{"op":"move","path":"/a"}]`, false},
+		{"move into itself", `[{"op":"move","from":"/a","path":"/a/b"}]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.patch))
+			if tt.ok && err != nil {
+				t.Errorf("Parse() error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrMalformed) {
+				t.Errorf("Parse() error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+// Most cases are the examples of RFC 6902, appendix A.
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc, patch string
+		want       string
+		wantErr    error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrTestFailed},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", ErrPath},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`, nil},
+		{"test string against number", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, "", ErrTestFailed},
+		{"test numbers by value", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`, nil},
+		{"test objects regardless of order", `{"a":{"x":1,"y":2}}`, `[{"op":"test","path":"/a","value":{"y":2,"x":1}}]`, `{"a":{"x":1,"y":2}}`, nil},
+		{"add array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, nil},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, nil},
+		{"remove missing", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, "", ErrPath},
+		{"replace missing", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", ErrPath},
+		{"index out of bounds", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, "", ErrPath},
+		{"index with leading zero", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, "", ErrPath},
+		{"all or nothing", `{"a":1}`, `[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`, "", ErrTestFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := Parse([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+
+			got, err := patch.Apply([]byte(tt.doc))
+			if tt.wantErr != nil {
+				var opErr *OperationError
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &opErr) {
+					t.Errorf("Apply() error = %v, want an OperationError wrapping %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyKeepsLargeNumbers(t *testing.T) {
+	patch, err := Parse([]byte(`[{"op":"add","path":"/b","value":12345678901234567890}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := patch.Apply([]byte(`{"a":9007199254740993}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":9007199254740993,"b":12345678901234567890}`; string(got) != want {
+		t.Errorf("Apply() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+// Package validation checks request payloads against rules declared in struct tags, and
+// reports every broken rule with the JSON name of its field, so clients can point at the
+// inputs to fix:
+//
+//	type EmployeeCreate struct {
+//		Email string `json:"email" validate:"required,email,max=50"`
+//	}
+//
+// The rules are required, email, password, min=N and max=N (in characters). Rules other
+// than required are skipped for empty values.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The codes of the field errors.
+const (
+	CodeRequired     = "required"
+	CodeEmail        = "email"
+	CodeMinLength    = "min_length"
+	CodeMaxLength    = "max_length"
+	CodePassword     = "password"
+	CodeUnknownField = "unknown_field"
+	CodeInvalidType  = "invalid_type"
+)
+
+// The password rule: bcrypt ignores everything past 72 bytes, so longer passwords are
+// refused rather than silently truncated.
+const (
+	minPasswordLength = 8
+	maxPasswordBytes  = 72
+)
+
+// FieldError is one broken rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors are the broken rules of a payload.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Field + ": " + err.Message
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Struct checks the string fields of v, a struct or a pointer to one, against their
+// validate tags. It returns nil when every rule holds.
+func Struct(v any) Errors {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: can't validate a %s", value.Kind()))
+	}
+
+	var errs Errors
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" || field.Type.Kind() != reflect.String {
+			continue
+		}
+
+		if err := checkField(FieldName(field), value.Field(i).String(), tag); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+
+	return errs
+}
+
+// Var checks one value against the rules of a validate tag, reporting it as field.
+func Var(field, value, rules string) Errors {
+	if err := checkField(field, value, rules); err != nil {
+		return Errors{*err}
+	}
+
+	return nil
+}
+
+// FieldName returns the name of a struct field in JSON.
+func FieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
+
+// checkField returns the first rule of rules that value breaks.
+func checkField(field, value, rules string) *FieldError {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if strings.TrimSpace(value) == "" {
+				return &FieldError{field, CodeRequired, "is required"}
+			}
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		switch name {
+		case "email":
+			address, err := mail.ParseAddress(value)
+			if err != nil || address.Address != value {
+				return &FieldError{field, CodeEmail, "must be an email address"}
+			}
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				panic(fmt.Sprintf("validation: invalid rule %q", rule))
+			}
+			length := utf8.RuneCountInString(value)
+			if name == "min" && length < n {
+				return &FieldError{field, CodeMinLength, fmt.Sprintf("must be at least %d characters", n)}
+			}
+			if name == "max" && length > n {
+				return &FieldError{field, CodeMaxLength, fmt.Sprintf("must be at most %d characters", n)}
+			}
+		case "password":
+			if err := checkPassword(value); err != "" {
+				return &FieldError{field, CodePassword, err}
+			}
+		default:
+			panic(fmt.Sprintf("validation: unknown rule %q", rule))
+		}
+	}
+
+	return nil
+}
+
+// checkPassword returns what is wrong with a password: it must have at least 8
+// characters, at most 72 bytes, and both letters and digits.
+func checkPassword(password string) string {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Sprintf("must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Sprintf("must be at most %d bytes", maxPasswordBytes)
+	}
+
+	var letter, digit bool
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	if !letter || !digit {
+		return "must contain both letters and digits"
+	}
+
+	return ""
+}
@@ -0,0 +1,90 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPayload struct {
+	Email    string `json:"email" validate:"required,email,max=20"`
+	Name     string `json:"name,omitempty" validate:"min=2,max=5"`
+	Password string `json:"password" validate:"password"`
+	Note     string
+	Count    int `json:"count" validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+	if errs := Struct(testPayload{Email: "ada@example.com", Name: "Ada", Password: "secret123"}); errs != nil {
+		t.Errorf("Struct() of a valid payload = %v", errs)
+	}
+
+	// the empty name and password are skipped, and the int isn't checked
+	if errs := Struct(&testPayload{Email: "ada@example.com"}); errs != nil {
+		t.Errorf("Struct() of a payload with empty optional fields = %v", errs)
+	}
+
+	errs := Struct(testPayload{Email: "Ada <ada@example.com>", Name: "Ädäläidä", Password: "secret"})
+	want := Errors{
+		{Field: "email", Code: CodeEmail, Message: "must be an email address"},
+		{Field: "name", Code: CodeMaxLength, Message: "must be at most 5 characters"},
+		{Field: "password", Code: CodePassword, Message: "must be at least 8 characters"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("Struct() = %+v, want %+v", errs, want)
+	}
+	if got := errs.Error(); !strings.HasPrefix(got, "email: must be an email address; name: ") {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestVar(t *testing.T) {
+	tests := []struct {
+		value string
+		rules string
+		want  string
+	}{
+		{"", "required", CodeRequired},
+		{"   ", "required,email", CodeRequired},
+		{"", "email,min=3", ""},
+		{"a@b", "email", ""},
+		{"not an email", "email", CodeEmail},
+		{"ab", "min=3", CodeMinLength},
+		{"äää", "min=3,max=3", ""},
+		{"abcd", "max=3", CodeMaxLength},
+		{"secret123", "password", ""},
+		{"password", "password", CodePassword},
+		{"12345678", "password", CodePassword},
+		{strings.Repeat("a1", 37), "password", CodePassword},
+	}
+
+	for _, tt := range tests {
+		errs := Var("field", tt.value, tt.rules)
+		got := ""
+		if errs != nil {
+			got = errs[0].Code
+		}
+		if got != tt.want {
+			t.Errorf("Var(%q, %q) = %v, want code %q", tt.value, tt.rules, errs, tt.want)
+		}
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unknown rule didn't panic")
+		}
+	}()
+
+	Var("field", "value", "uppercase")
+}
+
+func TestFieldName(t *testing.T) {
+	typ := reflect.TypeOf(testPayload{})
+	for i, want := range []string{"email", "name", "password", "Note", "count"} {
+		if got := FieldName(typ.Field(i)); got != want {
+			t.Errorf("FieldName(%s) = %q, want %q", typ.Field(i).Name, got, want)
+		}
+	}
+}